@@ -0,0 +1,178 @@
+// Command replay turns a tarball produced by lib/recorder back into a
+// reproducible run: either resending the recorded analyzer upload to a target
+// URL, or serving the recorded upstream responses locally so the crawl can be
+// re-run deterministically against a fixed corpus.
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+)
+
+type recordedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func main() {
+	tarPath := flag.String("tar", "", "path to a recorded crawl tarball")
+	analyzerURL := flag.String("analyzer-url", "", "resend the recorded analyzer upload to this URL")
+	serve := flag.Bool("serve", false, "serve the recorded upstream responses via a local HTTP server")
+	flag.Parse()
+
+	if *tarPath == "" {
+		log.Fatal("usage: replay -tar <path> [-analyzer-url <url> | -serve]")
+	}
+
+	entries, err := readTarball(*tarPath)
+	if err != nil {
+		log.Fatalf("read tarball: %v", err)
+	}
+
+	switch {
+	case *analyzerURL != "":
+		if err := replayUpload(entries, *analyzerURL); err != nil {
+			log.Fatalf("replay upload: %v", err)
+		}
+	case *serve:
+		if err := serveRecorded(entries); err != nil {
+			log.Fatalf("serve recorded responses: %v", err)
+		}
+	default:
+		log.Fatal("nothing to do: pass -analyzer-url or -serve")
+	}
+}
+
+func readTarball(path string) (map[string][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := map[string][]byte{}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("read entry %s: %w", hdr.Name, err)
+		}
+		entries[hdr.Name] = data
+	}
+	return entries, nil
+}
+
+func replayUpload(entries map[string][]byte, analyzerURL string) error {
+	upload, ok := entries["analyzer-upload.bin"]
+	if !ok {
+		return fmt.Errorf("tarball has no analyzer-upload.bin entry")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, analyzerURL, bytes.NewReader(upload))
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	fmt.Printf("analyzer responded %d: %s\n", resp.StatusCode, body)
+	return nil
+}
+
+func serveRecorded(entries map[string][]byte) error {
+	pages, err := parseRecordedResponses(entries)
+	if err != nil {
+		return err
+	}
+	if len(pages) == 0 {
+		return fmt.Errorf("tarball has no recorded page responses")
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, ok := pages[r.URL.RequestURI()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		for k, vs := range resp.header {
+			for _, v := range vs {
+				w.Header().Add(k, v)
+			}
+		}
+		w.WriteHeader(resp.status)
+		_, _ = w.Write(resp.body)
+	}))
+	defer srv.Close()
+
+	fmt.Printf("serving %d recorded responses on %s — press Ctrl+C to stop\n", len(pages), srv.URL)
+	select {}
+}
+
+// parseRecordedResponses reads manifest.json to recover fetch order, then parses
+// each page-NNNN.resp entry as a raw HTTP response, keyed by request path+query
+// since the server replaying them runs on a different host:port than the original crawl.
+func parseRecordedResponses(entries map[string][]byte) (map[string]recordedResponse, error) {
+	manifestData, ok := entries["manifest.json"]
+	if !ok {
+		return nil, fmt.Errorf("tarball has no manifest.json entry")
+	}
+
+	var manifest struct {
+		Pages []struct {
+			URL string `json:"url"`
+		} `json:"pages"`
+	}
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, fmt.Errorf("parse manifest.json: %w", err)
+	}
+
+	out := make(map[string]recordedResponse, len(manifest.Pages))
+	for idx, p := range manifest.Pages {
+		data, ok := entries[fmt.Sprintf("page-%04d.resp", idx+1)]
+		if !ok {
+			continue
+		}
+
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil)
+		if err != nil {
+			log.Printf("[replay:warning] skipping unparseable response for %s: %v", p.URL, err)
+			continue
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		parsed, err := url.Parse(p.URL)
+		if err != nil {
+			log.Printf("[replay:warning] skipping unparseable URL %q: %v", p.URL, err)
+			continue
+		}
+
+		out[parsed.RequestURI()] = recordedResponse{status: resp.StatusCode, header: resp.Header, body: body}
+	}
+	return out, nil
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"net/http"
 	"time"
+	"go-fetcher/lib/transport"
 	"go-fetcher/utils"
 )
 
@@ -25,6 +26,26 @@ type Config struct {
 	AnalyzerConc   int
 	AnalyzerGzip   bool
 
+	// Archive Settings
+	OutputFormat string // "zip" or "warc"
+	StreamUpload bool   // upload pages to the analyzer as they're fetched instead of batching in memory
+
+	// Recorder Settings
+	RecordDir        string  // empty disables recording entirely
+	RecordSampleRate float64 // fraction of crawls to record (0..1), forced crawls record regardless
+
+	// Robots / Politeness Settings
+	RobotsEnabled        bool
+	RobotsDefaultDelayMS int
+	RobotsOverrideUA     string
+
+	// Per-host throttling for both the in-process queue and the Redis frontier
+	HostConcurrency int // MaxInFlightPerHost: concurrent fetches allowed to the same host
+
+	// Frontier / resumability Settings
+	FrontierTTL   time.Duration // how long an idle crawl's Redis frontier keys survive
+	ActiveLeaseTTL time.Duration // how long before a crawl with no lease renewal is presumed abandoned
+
 	// MinIO Settings
 	MinioEndpoint string
 	MinioAccessKey string
@@ -35,10 +56,25 @@ type Config struct {
 	// Redis Settings (for Dead Letter Queue)
 	RedisAddr string
 
+	// DLQ redelivery backoff Settings
+	DLQBaseBackoff time.Duration
+	DLQMaxBackoff  time.Duration
+	DLQMultiplier  float64
+	DLQMaxRetries  int
+
+	// Event stream (SSE replay) Settings
+	EventStreamTTL    time.Duration // matches the DLQ's 30-day window
+	EventStreamMaxLen int64         // approx cap on events kept per request_id
+
 	// HTTP Clients
 	HTTPClient    *http.Client
 	AnalyzerClient *http.Client
 
+	// Transports backing the clients above, exposed separately so callers can
+	// report their per-host stats (see Handler.SetTransports).
+	CrawlTransport    *transport.RoundTripper
+	AnalyzerTransport *transport.RoundTripper
+
 	// CORS
 	AllowedOrigin string
 }
@@ -63,38 +99,68 @@ func Init() *Config {
 		AnalyzerURL:     utils.GetEnv("PYTHON_ANALYZER_URL", "http://python-analyzer:8000/webhook/task_done"),
 		AnalyzerConc:    utils.EnvInt("ANALYZER_CONCURRENCY", 8),
 		AnalyzerGzip:    utils.EnvInt("ANALYZER_GZIP", 1) == 1,
+		OutputFormat:    utils.GetEnv("OUTPUT_FORMAT", "zip"),
+		StreamUpload:    utils.EnvInt("STREAM_UPLOAD", 0) == 1,
+		RecordDir:        utils.GetEnv("RECORD_DIR", ""),
+		RecordSampleRate: utils.EnvFloat("RECORD_SAMPLE", 0),
+		RobotsEnabled:        utils.EnvInt("ROBOTS_ENABLED", 1) == 1,
+		RobotsDefaultDelayMS: utils.EnvInt("ROBOTS_DEFAULT_DELAY_MS", 200),
+		RobotsOverrideUA:     utils.GetEnv("ROBOTS_OVERRIDE_UA", "go-crawler"),
+		HostConcurrency:      utils.EnvInt("HOST_CONCURRENCY", 2),
+		FrontierTTL:          time.Duration(utils.EnvInt("FRONTIER_TTL_SECS", 24*3600)) * time.Second,
+		ActiveLeaseTTL:       time.Duration(utils.EnvInt("ACTIVE_LEASE_TTL_SECS", 60)) * time.Second,
 		MinioEndpoint:   utils.GetEnv("MINIO_ENDPOINT", "minio:7000"),
 		MinioAccessKey:  utils.GetEnv("MINIO_ACCESS_KEY", "admin"),
 		MinioSecretKey:  utils.GetEnv("MINIO_SECRET_KEY", "minioadmin"),
 		MinioUseSSL:     utils.GetEnv("MINIO_USE_SSL", "false") == "true",
 		MinioBucket:     utils.GetEnv("MINIO_BUCKET", "crawler-pages"),
 		RedisAddr:       utils.GetEnv("REDIS_ADDR", "redis:6379"),
+		DLQBaseBackoff:  time.Duration(utils.EnvInt("DLQ_BASE_BACKOFF_SECS", 2)) * time.Second,
+		DLQMaxBackoff:   time.Duration(utils.EnvInt("DLQ_MAX_BACKOFF_SECS", 300)) * time.Second,
+		DLQMultiplier:   utils.EnvFloat("DLQ_BACKOFF_MULTIPLIER", 2),
+		DLQMaxRetries:   utils.EnvInt("DLQ_MAX_RETRIES", 5),
+		EventStreamTTL:    time.Duration(utils.EnvInt("EVENT_STREAM_TTL_SECS", 30*24*3600)) * time.Second,
+		EventStreamMaxLen: int64(utils.EnvInt("EVENT_STREAM_MAXLEN", 1000)),
 		AllowedOrigin:   utils.GetEnv("ALLOWED_ORIGIN", "*"),
 	}
 
+	// Retry/circuit-breaker policy shared by both clients below, so a flaky
+	// domain trips its own breaker instead of starving the worker pool.
+	transportConfig := transport.Config{
+		MaxRetries:    utils.EnvInt("TRANSPORT_MAX_RETRIES", 3),
+		BaseBackoff:   time.Duration(utils.EnvInt("TRANSPORT_BASE_BACKOFF_MS", 200)) * time.Millisecond,
+		MaxBackoff:    time.Duration(utils.EnvInt("TRANSPORT_MAX_BACKOFF_MS", 5000)) * time.Millisecond,
+		Multiplier:    utils.EnvFloat("TRANSPORT_BACKOFF_MULTIPLIER", 2),
+		FailureThresh: utils.EnvInt("TRANSPORT_FAILURE_THRESHOLD", 5),
+		Window:        time.Duration(utils.EnvInt("TRANSPORT_WINDOW_SECS", 30)) * time.Second,
+		Cooldown:      time.Duration(utils.EnvInt("TRANSPORT_COOLDOWN_SECS", 30)) * time.Second,
+	}
+
 	// Setup HTTP clients
-	cfg.HTTPClient = &http.Client{
-		Timeout: cfg.Timeout,
+	cfg.CrawlTransport = transport.New(&http.Transport{
 		// Dynamic connection pool: Can scale up if more resources available
 		// Defaults are conservative for 12GB system, but can be increased via env vars
-		Transport: &http.Transport{
-			MaxIdleConns:        utils.EnvInt("HTTP_MAX_IDLE_CONNS", 256),
-			MaxIdleConnsPerHost: utils.EnvInt("HTTP_MAX_IDLE_CONNS_PER_HOST", 64),
-			IdleConnTimeout:     90 * time.Second,
-		},
+		MaxIdleConns:        utils.EnvInt("HTTP_MAX_IDLE_CONNS", 256),
+		MaxIdleConnsPerHost: utils.EnvInt("HTTP_MAX_IDLE_CONNS_PER_HOST", 64),
+		IdleConnTimeout:     90 * time.Second,
+	}, transportConfig)
+	cfg.HTTPClient = &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: cfg.CrawlTransport,
 	}
 
 	// Increased timeout for large batches - analyzer needs time to read and process large payloads
 	analyzerTimeout := time.Duration(utils.EnvInt("ANALYZER_TIMEOUT_SECS", 180)) * time.Second
-	cfg.AnalyzerClient = &http.Client{
-		Timeout: analyzerTimeout,
+	cfg.AnalyzerTransport = transport.New(&http.Transport{
 		// Dynamic connection pool: Can scale up if more resources available
-		Transport: &http.Transport{
-			MaxIdleConns:        utils.EnvInt("ANALYZER_MAX_IDLE_CONNS", 256),
-			MaxIdleConnsPerHost: utils.EnvInt("ANALYZER_MAX_IDLE_CONNS_PER_HOST", 64),
-			IdleConnTimeout:     90 * time.Second,
-			ResponseHeaderTimeout: 180 * time.Second, // Timeout for reading response headers
-		},
+		MaxIdleConns:          utils.EnvInt("ANALYZER_MAX_IDLE_CONNS", 256),
+		MaxIdleConnsPerHost:   utils.EnvInt("ANALYZER_MAX_IDLE_CONNS_PER_HOST", 64),
+		IdleConnTimeout:       90 * time.Second,
+		ResponseHeaderTimeout: 180 * time.Second, // Timeout for reading response headers
+	}, transportConfig)
+	cfg.AnalyzerClient = &http.Client{
+		Timeout:   analyzerTimeout,
+		Transport: cfg.AnalyzerTransport,
 	}
 
 	AppConfig = cfg
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"bytes"
 	"compress/gzip"
 	"context"
 	"encoding/json"
@@ -10,7 +11,11 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
+
+	"go-fetcher/lib/recorder"
+	"go-fetcher/lib/transport"
 )
 
 // AnalyzerClient handles sending batches to the analyzer with retry logic
@@ -19,19 +24,22 @@ type AnalyzerClient struct {
 	analyzerURL     string
 	useGzip         bool
 	maxRetries      int
-	retryBackoff    time.Duration
 	eventHub        *EventHub // For publishing failure events
+	recorder        recorder.Recorder
 }
 
-// NewAnalyzerClient creates a new analyzer client
+// NewAnalyzerClient creates a new analyzer client. httpClient's Transport is
+// expected to already be a *transport.RoundTripper (see config.Init) so
+// transient dial/5xx errors on GETs are retried there; SendBatch's own loop
+// only has to cover the non-idempotent POST body itself, which the transport
+// can't safely replay since it streams via io.Pipe.
 func NewAnalyzerClient(httpClient *http.Client, analyzerURL string, useGzip bool) *AnalyzerClient {
 	return &AnalyzerClient{
-		httpClient:      httpClient,
-		analyzerURL:     analyzerURL,
-		useGzip:         useGzip,
-		maxRetries:      3,
-		retryBackoff:    2 * time.Second,
-		eventHub:        nil,
+		httpClient:  httpClient,
+		analyzerURL: analyzerURL,
+		useGzip:     useGzip,
+		maxRetries:  3,
+		eventHub:    nil,
 	}
 }
 
@@ -39,42 +47,68 @@ func (ac *AnalyzerClient) SetEventHub(eh *EventHub) {
 	ac.eventHub = eh
 }
 
+// SetRecorder enables capturing the exact bytes POSTed to the analyzer for each
+// recorded request_id, so a failed delivery can be replayed later. Pass nil to disable.
+// Only SendBatch and SendWARCBatch uploads are captured, not OpenBatchStream
+// ones, and each captured upload replaces the one recorded before it.
+func (ac *AnalyzerClient) SetRecorder(r recorder.Recorder) {
+	ac.recorder = r
+}
+
 // ================================
 // PUBLIC ENTRYPOINT
 // ================================
-func (ac *AnalyzerClient) SendBatch(batch PageBatch) error {
+func (ac *AnalyzerClient) SendBatch(ctx context.Context, batch PageBatch) error {
+	return ac.withRetries(ctx, batch.RequestID, fmt.Sprintf("batch %s", batch.RequestID), func() error {
+		return ac.sendBatchOnce(ctx, batch)
+	})
+}
+
+// withRetries runs fn up to ac.maxRetries+1 times with transport.Backoff
+// delays between attempts, publishing a batch_delivery_failed event and
+// returning the last error once every attempt is exhausted. label identifies
+// the delivery attempt in log lines and that event. Shared by SendBatch and
+// SendWARCBatch so the retry/backoff policy lives in exactly one place.
+func (ac *AnalyzerClient) withRetries(ctx context.Context, requestID, label string, fn func() error) error {
 	var lastErr error
-	ctx := context.Background()
 
 	for attempt := 0; attempt <= ac.maxRetries; attempt++ {
 
-		err := ac.sendBatchOnce(ctx, batch)
+		err := fn()
 		if err == nil {
 			if attempt > 0 {
-				log.Printf("[analyzer_client] Batch %s succeeded on retry #%d", batch.RequestID, attempt)
+				log.Printf("[analyzer_client] %s succeeded on retry #%d", label, attempt)
 			}
 			return nil
 		}
 
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
 		lastErr = err
 
 		if attempt < ac.maxRetries {
-			backoff := ac.retryBackoff * time.Duration(1<<uint(attempt))
-			log.Printf("[analyzer_client:warning] Batch %s failed attempt %d/%d: %v — retrying in %v",
-				batch.RequestID, attempt+1, ac.maxRetries+1, err, backoff)
-			time.Sleep(backoff)
+			backoff := transport.Backoff(attempt+1, 2*time.Second, 30*time.Second, 2)
+			log.Printf("[analyzer_client:warning] %s failed attempt %d/%d: %v — retrying in %v",
+				label, attempt+1, ac.maxRetries+1, err, backoff)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 		}
 	}
 
-	errorMsg := fmt.Sprintf("Failed to deliver batch %s after %d retries: %v",
-		batch.RequestID, ac.maxRetries+1, lastErr)
+	errorMsg := fmt.Sprintf("Failed to deliver %s after %d retries: %v",
+		label, ac.maxRetries+1, lastErr)
 
 	log.Printf("[analyzer_client:error] %s", errorMsg)
 
 	if ac.eventHub != nil {
 		ac.eventHub.Publish(ProgressEvent{
 			Type:      "batch_delivery_failed",
-			RequestID: batch.RequestID,
+			RequestID: requestID,
 			Message:   errorMsg,
 		})
 	}
@@ -90,9 +124,17 @@ func (ac *AnalyzerClient) sendBatchOnce(ctx context.Context, batch PageBatch) er
 	// Pipe to stream JSON → gzip → HTTP request body
 	pr, pw := io.Pipe()
 
+	// Tee the exact wire bytes into the recorder, if batch.RequestID was selected for capture.
+	var recorded *bytes.Buffer
+	var out io.Writer = pw
+	if ac.recorder != nil {
+		recorded = &bytes.Buffer{}
+		out = io.MultiWriter(pw, recorded)
+	}
+
 	var gw *gzip.Writer
 	if ac.useGzip {
-		gw = gzip.NewWriter(pw)
+		gw = gzip.NewWriter(out)
 	}
 
 	// Encode JSON in a background goroutine
@@ -102,7 +144,7 @@ func (ac *AnalyzerClient) sendBatchOnce(ctx context.Context, batch PageBatch) er
 		if ac.useGzip {
 			enc = json.NewEncoder(gw)
 		} else {
-			enc = json.NewEncoder(pw)
+			enc = json.NewEncoder(out)
 		}
 
 		err := enc.Encode(batch)
@@ -110,6 +152,9 @@ func (ac *AnalyzerClient) sendBatchOnce(ctx context.Context, batch PageBatch) er
 		if ac.useGzip {
 			_ = gw.Close()
 		}
+		if recorded != nil {
+			ac.recorder.RecordUpload(batch.RequestID, recorded.Bytes())
+		}
 		_ = pw.CloseWithError(err)
 	}()
 
@@ -160,6 +205,224 @@ func (ac *AnalyzerClient) sendBatchOnce(ctx context.Context, batch PageBatch) er
 	return nil
 }
 
+// ================================
+// WARC BATCH UPLOAD (OUTPUT_FORMAT=warc)
+// ================================
+
+// warcManifest is the trailing JSON "resource" record sendWARCBatchOnce
+// appends after a batch's real WARC records, carrying the bookkeeping
+// PageBatch otherwise holds alongside its archive — a WARC stream has
+// nowhere else to put request/batch IDs or stats.
+type warcManifest struct {
+	RequestID  string         `json:"request_id"`
+	BatchID    string         `json:"batch_id"`
+	MainURL    string         `json:"main_url"`
+	IsComplete bool           `json:"is_complete"`
+	TotalPages int            `json:"total_pages"`
+	Metadata   []PageMetadata `json:"metadata"`
+	Stats      BatchStats     `json:"stats"`
+}
+
+// SendWARCBatch streams mainURL's pages straight into the analyzer POST body
+// as WARC/1.1 records (see writeWARCRecords) instead of building a PageBatch
+// with a base64-encoded archive first, so the batch is never fully
+// materialized or base64-encoded in memory.
+func (ac *AnalyzerClient) SendWARCBatch(ctx context.Context, requestID, batchID, mainURL string, pages []PageContent) error {
+	return ac.withRetries(ctx, requestID, fmt.Sprintf("WARC batch %s", batchID), func() error {
+		return ac.sendWARCBatchOnce(ctx, requestID, batchID, mainURL, pages)
+	})
+}
+
+// sendWARCBatchOnce pipes WARC records directly into the HTTP request body.
+// Each record gzips itself (see WARCWriter), so unlike sendBatchOnce there's
+// no outer gzip.Writer and no JSON envelope — the body is the .warc.gz file
+// verbatim, terminated by a warcManifest resource record.
+func (ac *AnalyzerClient) sendWARCBatchOnce(ctx context.Context, requestID, batchID, mainURL string, pages []PageContent) error {
+	pr, pw := io.Pipe()
+
+	var recorded *bytes.Buffer
+	var out io.Writer = pw
+	if ac.recorder != nil {
+		recorded = &bytes.Buffer{}
+		out = io.MultiWriter(pw, recorded)
+	}
+
+	go func() {
+		ww := NewWARCWriter(out)
+		metadata, stats, err := writeWARCRecords(ww, mainURL, pages)
+		if err == nil {
+			var manifest []byte
+			manifest, err = json.Marshal(warcManifest{
+				RequestID:  requestID,
+				BatchID:    batchID,
+				MainURL:    mainURL,
+				IsComplete: true,
+				TotalPages: len(metadata),
+				Metadata:   metadata,
+				Stats:      stats,
+			})
+			if err == nil {
+				_, err = ww.WriteResource(mainURL, "application/json", manifest)
+			}
+		}
+		if recorded != nil {
+			ac.recorder.RecordUpload(requestID, recorded.Bytes())
+		}
+		_ = pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ac.analyzerURL, pr)
+	if err != nil {
+		_ = pr.Close()
+		return fmt.Errorf("request creation failed: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/warc")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Connection", "close")
+	req.Header.Set("X-Request-ID", requestID)
+
+	resp, err := ac.httpClient.Do(req)
+	if err != nil {
+		_ = pr.Close()
+
+		if isTransientNetErr(err) {
+			return fmt.Errorf("transient http error: %w", err)
+		}
+		return fmt.Errorf("http request failed: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 5*1024*1024))
+
+	if resp.StatusCode == 202 {
+		log.Printf("[analyzer_client] WARC batch %s accepted for async processing (202)", batchID)
+		return nil
+	}
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("analyzer returned HTTP %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	log.Printf("[analyzer_client] WARC batch %s delivered successfully", batchID)
+	return nil
+}
+
+// ================================
+// STREAMING UPLOAD (STREAM_UPLOAD=1)
+// ================================
+
+// BatchStream lets a crawl upload pages to the analyzer as they're fetched instead
+// of buffering a full PageBatch in memory first. Records are written as
+// newline-delimited JSON into a gzip writer that feeds an io.Pipe whose read end
+// is the body of a single POST running in the background.
+type BatchStream struct {
+	requestID string
+	pw        *io.PipeWriter
+	gw        *gzip.Writer
+	enc       *json.Encoder
+	mu        sync.Mutex
+	stats     BatchStats
+	done      chan error
+}
+
+// batchStreamTrailer is written once, last, so the analyzer knows the final
+// success/failure tally without having to count records itself.
+type batchStreamTrailer struct {
+	Final bool       `json:"final"`
+	Stats BatchStats `json:"stats"`
+}
+
+// OpenBatchStream starts the background POST and returns a handle the caller
+// writes pages into via WritePage. The request stays open until Close is called.
+func (ac *AnalyzerClient) OpenBatchStream(requestID string) (*BatchStream, error) {
+	pr, pw := io.Pipe()
+	gw := gzip.NewWriter(pw)
+
+	req, err := http.NewRequest(http.MethodPost, ac.analyzerURL, pr)
+	if err != nil {
+		_ = pr.Close()
+		return nil, fmt.Errorf("request creation failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Connection", "close")
+	req.Header.Set("X-Request-ID", requestID)
+
+	bs := &BatchStream{
+		requestID: requestID,
+		pw:        pw,
+		gw:        gw,
+		enc:       json.NewEncoder(gw),
+		done:      make(chan error, 1),
+	}
+
+	go func() {
+		resp, err := ac.httpClient.Do(req)
+		if err != nil {
+			bs.done <- fmt.Errorf("http request failed: %w", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 5*1024*1024))
+		if resp.StatusCode != http.StatusAccepted && (resp.StatusCode < 200 || resp.StatusCode >= 300) {
+			bs.done <- fmt.Errorf("analyzer returned HTTP %d: %s", resp.StatusCode, string(respBody))
+			return
+		}
+		bs.done <- nil
+	}()
+
+	return bs, nil
+}
+
+// WritePage streams one fetched page to the analyzer. Safe for concurrent callers.
+func (bs *BatchStream) WritePage(page PageContent) error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if page.Error != "" || page.HTML == "" {
+		bs.stats.Failed++
+	} else {
+		bs.stats.Successful++
+	}
+	return bs.enc.Encode(page)
+}
+
+// Close writes the trailing stats record, closes the stream and waits for the
+// analyzer's response. Once Close returns with an error the underlying POST is
+// dead and cannot be retried; BatchStream keeps no copy of the pages already
+// written to it.
+func (bs *BatchStream) Close() error {
+	bs.mu.Lock()
+	trailerErr := bs.enc.Encode(batchStreamTrailer{Final: true, Stats: bs.stats})
+	bs.mu.Unlock()
+
+	if trailerErr != nil {
+		_ = bs.gw.Close()
+		_ = bs.pw.CloseWithError(trailerErr)
+		<-bs.done
+		return trailerErr
+	}
+
+	if err := bs.gw.Close(); err != nil {
+		_ = bs.pw.CloseWithError(err)
+		<-bs.done
+		return err
+	}
+
+	if err := bs.pw.Close(); err != nil {
+		return err
+	}
+
+	return <-bs.done
+}
+
 // ================================
 // TRANSIENT ERROR DETECTOR
 // ================================
@@ -56,6 +56,64 @@ func buildCompressedArchive(mainURL string, pages []PageContent) (string, []Page
 	return base64.StdEncoding.EncodeToString(buf.Bytes()), metadata, stats, nil
 }
 
+// writeWARCRecords writes mainURL's pages into ww as WARC/1.1 records, each
+// its own gzip member: a leading warcinfo record, then a request/response
+// pair per successfully fetched page, or a single metadata record referencing
+// the target URI for a page that failed to fetch. Unlike buildCompressedArchive,
+// this never materializes the archive in memory first — ww typically wraps
+// the pipe feeding an HTTP request body directly (see SendWARCBatch), so
+// records go out as they're written.
+func writeWARCRecords(ww *WARCWriter, mainURL string, pages []PageContent) ([]PageMetadata, BatchStats, error) {
+	metadata := make([]PageMetadata, 0, len(pages))
+	stats := BatchStats{}
+
+	if _, err := ww.WriteWarcinfo(mainURL); err != nil {
+		return nil, stats, err
+	}
+
+	for _, page := range pages {
+		meta := PageMetadata{
+			URL:         page.URL,
+			ContentType: page.ContentType,
+			Error:       page.Error,
+		}
+
+		if page.Error != "" || page.HTML == "" {
+			stats.Failed++
+			info, err := ww.WriteMetadata(page.URL, fmt.Sprintf("fetch error: %s", page.Error))
+			if err != nil {
+				return nil, stats, err
+			}
+			meta.WARCRecordID = info.ID
+			meta.WARCPayloadDigest = info.PayloadDigest
+			meta.SizeBytes = info.ContentLength
+			metadata = append(metadata, meta)
+			continue
+		}
+
+		if _, err := ww.WriteRequest(page.URL, nil); err != nil {
+			return nil, stats, err
+		}
+		status := page.StatusCode
+		if status == 0 {
+			status = 200
+		}
+		info, err := ww.WriteResponse(page.URL, status, page.Headers, []byte(page.HTML))
+		if err != nil {
+			return nil, stats, err
+		}
+
+		meta.WARCRecordID = info.ID
+		meta.WARCPayloadDigest = info.PayloadDigest
+		meta.HasHTML = true
+		meta.SizeBytes = info.ContentLength
+		stats.Successful++
+		metadata = append(metadata, meta)
+	}
+
+	return metadata, stats, nil
+}
+
 func writeZipEntry(z *zip.Writer, fileName, html string) error {
 	w, err := z.Create(fileName)
 	if err != nil {
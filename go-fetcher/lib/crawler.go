@@ -1,12 +1,17 @@
 package lib
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/url"
+	"os"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"go-fetcher/utils"
@@ -14,10 +19,15 @@ import (
 
 // Crawler handles the crawling logic
 type Crawler struct {
-	pageFetcher    *PageFetcher
-	analyzerClient *AnalyzerClient
-	eventHub       *EventHub
-	config         CrawlerConfig
+	pageFetcher     *PageFetcher
+	transferManager *TransferManager
+	analyzerClient  *AnalyzerClient
+	eventHub        *EventHub
+	politeness      *PolitenessManager // nil disables robots.txt/sitemap handling and Crawl-delay pacing; CrawlerConfig's per-host gates still apply
+	frontier        Frontier           // nil falls back to an in-process queue that doesn't survive a restart
+	config          CrawlerConfig
+
+	cancels sync.Map // requestID -> context.CancelFunc, see StartCrawl/Cancel
 }
 
 // CrawlerConfig holds crawler configuration
@@ -26,20 +36,51 @@ type CrawlerConfig struct {
 	ProgressEveryN  int
 	PerSeedWorkers  int
 	MaxPagesPerSeed int
+	ArchiveFormat   string // "zip" or "warc", see crawlState.sendSingleBatch
+	StreamUpload    bool   // upload pages to the analyzer as they're fetched instead of batching in memory
+
+	// RespectRobots gates robots.txt/sitemap handling on top of politeness
+	// being configured at all, so a crawl can ignore robots.txt for a single
+	// run without tearing down the shared PolitenessManager.
+	RespectRobots bool
+	// DefaultCrawlDelay is the MinCrawlDelay the per-host gates (hostGateSet)
+	// enforce between fetches to the same host, in both crawlWithLocalQueue
+	// and crawlWithFrontier.
+	DefaultCrawlDelay time.Duration
+	// HostConcurrency is the MaxInFlightPerHost the same per-host gates
+	// enforce: the number of fetches to the same host allowed to run concurrently.
+	HostConcurrency int
 }
 
-// NewCrawler creates a new crawler
-func NewCrawler(pageFetcher *PageFetcher, analyzerClient *AnalyzerClient, eventHub *EventHub, config CrawlerConfig) *Crawler {
+// NewCrawler creates a new crawler. politeness may be nil to crawl without
+// robots.txt/sitemap handling or Crawl-delay pacing (the per-host limits from
+// config.DefaultCrawlDelay/HostConcurrency still apply). frontier may be nil to keep
+// the crawl queue in-process only, which is lost if go-fetcher restarts
+// mid-crawl; pass a *RedisFrontier to make crawls resumable across restarts.
+func NewCrawler(pageFetcher *PageFetcher, analyzerClient *AnalyzerClient, eventHub *EventHub, politeness *PolitenessManager, frontier Frontier, config CrawlerConfig) *Crawler {
 	return &Crawler{
-		pageFetcher:    pageFetcher,
-		analyzerClient: analyzerClient,
-		eventHub:       eventHub,
-		config:         config,
+		pageFetcher:     pageFetcher,
+		transferManager: NewTransferManager(pageFetcher),
+		analyzerClient:  analyzerClient,
+		eventHub:        eventHub,
+		politeness:      politeness,
+		frontier:        frontier,
+		config:          config,
 	}
 }
 
-// StartCrawl begins crawling the given URLs
-func (c *Crawler) StartCrawl(requestID string, urls []string) {
+// StartCrawl begins crawling the given URLs. It derives its own cancellable
+// context from ctx and registers it under requestID so a later Cancel(requestID)
+// call can stop every seed's workers without the caller having to hold onto
+// a context.CancelFunc itself.
+func (c *Crawler) StartCrawl(ctx context.Context, requestID string, urls []string) {
+	ctx, cancel := context.WithCancel(ctx)
+	c.cancels.Store(requestID, cancel)
+	defer func() {
+		c.cancels.Delete(requestID)
+		cancel()
+	}()
+
 	var wg sync.WaitGroup
 	for _, u := range urls {
 		if strings.TrimSpace(u) == "" {
@@ -49,36 +90,115 @@ func (c *Crawler) StartCrawl(requestID string, urls []string) {
 		go func(seed string) {
 			defer wg.Done()
 			c.eventHub.Publish(ProgressEvent{Type: "start", RequestID: requestID, URL: seed, Message: "started"})
-			if err := c.CrawlOneSeed(requestID, seed); err != nil {
+			if err := c.CrawlOneSeed(ctx, requestID, seed); err != nil {
 				c.eventHub.Publish(ProgressEvent{Type: "error", RequestID: requestID, URL: seed, Message: err.Error()})
 			}
 		}(u)
 	}
 	wg.Wait()
+
+	if ctx.Err() != nil {
+		return // Cancel already published the cancelled event
+	}
 	c.eventHub.Publish(ProgressEvent{Type: "complete", RequestID: requestID, Message: "all seeds completed"})
 }
 
-// CrawlOneSeed crawls a single seed URL
-func (c *Crawler) CrawlOneSeed(requestID, seed string) error {
+// Cancel stops requestID's crawl: every worker's next ctx.Done() check exits
+// instead of pulling more work, and a page fetch a worker is waiting on
+// returns early. Pages already fetched are still delivered to the analyzer,
+// since delivery runs on its own background context (see sendSingleBatch).
+// Returns false if requestID isn't currently running.
+func (c *Crawler) Cancel(requestID string) bool {
+	v, ok := c.cancels.Load(requestID)
+	if !ok {
+		return false
+	}
+	v.(context.CancelFunc)()
+	c.eventHub.Publish(ProgressEvent{Type: "cancelled", RequestID: requestID, Message: "cancelled by request"})
+	return true
+}
+
+// CrawlOneSeed crawls a single seed URL. The actual queueing strategy is
+// delegated to crawlWithFrontier (persistent, resumable) when a Frontier is
+// configured, or crawlWithLocalQueue (in-process only) otherwise.
+func (c *Crawler) CrawlOneSeed(ctx context.Context, requestID, seed string) error {
 	u, err := url.Parse(seed)
 	if err != nil || u.Host == "" {
 		return fmt.Errorf("invalid seed: %s", seed)
 	}
 	st := &crawlState{
-		requestID:     requestID,
-		mainURL:       seed,
-		mainHost:      strings.ToLower(u.Host),
-		visited:       make(map[string]struct{}),
-		maxPages:      c.config.MaxPagesPerSeed,
-		mu:            &sync.Mutex{},
-		pages:         make([]PageContent, 0, c.config.MaxPagesPerSeed),
-		pagesMu:       &sync.Mutex{},
+		requestID: requestID,
+		mainURL:   seed,
+		mainHost:  strings.ToLower(u.Host),
+		visited:   make(map[string]struct{}),
+		maxPages:  c.config.MaxPagesPerSeed,
+		mu:        &sync.Mutex{},
+		pages:     make([]PageContent, 0, c.config.MaxPagesPerSeed),
+		pagesMu:   &sync.Mutex{},
 	}
 
-	urlQueue := make(chan string, 1024)
-	var wg sync.WaitGroup
+	var stream *BatchStream
+	if c.config.StreamUpload {
+		s, err := c.analyzerClient.OpenBatchStream(requestID)
+		if err != nil {
+			log.Printf("[crawler:warning] failed to open analyzer stream for %s, buffering in memory instead: %v", requestID, err)
+		} else {
+			stream = s
+		}
+	}
+	var spool *diskSpool
+	var spoolOnce sync.Once
 
-	enqueue := func(link string) {
+	if c.frontier != nil {
+		c.crawlWithFrontier(ctx, requestID, seed, u, st, stream, &spool, &spoolOnce)
+	} else {
+		c.crawlWithLocalQueue(ctx, requestID, seed, u, st, stream, &spool, &spoolOnce)
+	}
+
+	if stream != nil {
+		if err := stream.Close(); err != nil {
+			// st only holds lightweight bookkeeping in streaming mode (see
+			// fetchAndIngest), not the full page bodies already handed to the
+			// stream, so there's nothing left to fall back to a buffered
+			// batch with — this crawl's pages are lost along with the stream.
+			log.Printf("[crawler:error] analyzer stream close failed for %s, %d pages could not be delivered: %v", requestID, len(st.pages), err)
+		}
+	} else {
+		st.sendSingleBatch(c.analyzerClient, c.config.ArchiveFormat)
+	}
+
+	if spool != nil {
+		st.resendSpooled(c.analyzerClient, spool, seed)
+	}
+
+	if ctx.Err() != nil {
+		c.eventHub.Publish(ProgressEvent{Type: "cancelled", RequestID: requestID, URL: seed, Message: "cancelled"})
+		return nil
+	}
+
+	done := int(atomic.LoadInt64(&st.processed))
+	total := int(atomic.LoadInt64(&st.enqueued))
+	c.eventHub.Publish(ProgressEvent{
+		Type:      "complete",
+		RequestID: requestID,
+		URL:       seed,
+		Done:      done,
+		Total:     total,
+		Percent:   utils.Percent(done, total),
+	})
+	return nil
+}
+
+// crawlWithLocalQueue runs the in-memory frontier: a per-host priority queue
+// (see hostPriorityQueue) plus a visited-set guarded by st.mu. Lost entirely
+// if the process restarts mid-crawl. Workers poll popReady rather than
+// ranging over a channel, so completion is tracked with a pending counter
+// instead of channel closure, the same convention crawlWithFrontier uses.
+func (c *Crawler) crawlWithLocalQueue(ctx context.Context, requestID, seed string, u *url.URL, st *crawlState, stream *BatchStream, spool **diskSpool, spoolOnce *sync.Once) {
+	pq := newHostPriorityQueue(c.config.HostConcurrency, c.config.DefaultCrawlDelay)
+	var pending int64
+
+	enqueue := func(link string, fromSitemap bool) {
 		link = NormalizeURL(st.mainURL, link)
 		if link == "" {
 			return
@@ -88,75 +208,285 @@ func (c *Crawler) CrawlOneSeed(requestID, seed string) error {
 			return
 		}
 
-		st.mu.Lock()
-		defer st.mu.Unlock()
+		if c.config.RespectRobots && c.politeness != nil && !c.politeness.Allowed(link) {
+			c.eventHub.Publish(ProgressEvent{Type: "robots_blocked", RequestID: requestID, URL: link, Message: "disallowed by robots.txt"})
+			return
+		}
 
+		st.mu.Lock()
 		if len(st.visited) >= st.maxPages {
+			st.mu.Unlock()
 			return
 		}
-
 		if _, ok := st.visited[link]; ok {
+			st.mu.Unlock()
 			return
 		}
 		st.visited[link] = struct{}{}
-		wg.Add(1)
+		st.mu.Unlock()
+
 		atomic.AddInt64(&st.enqueued, 1)
-		urlQueue <- link
+		atomic.AddInt64(&pending, 1)
+		pq.push(link, strings.ToLower(lu.Host), linkScore(link, link == seed, fromSitemap))
+	}
+
+	enqueue(seed, false)
+
+	if c.config.RespectRobots && c.politeness != nil {
+		for _, sitemapURL := range c.politeness.Sitemaps(seed) {
+			for _, loc := range c.politeness.FetchSitemap(sitemapURL) {
+				enqueue(loc, true)
+			}
+		}
 	}
 
-	enqueue(seed)
+	var wg sync.WaitGroup
 	for i := 0; i < c.config.PerSeedWorkers; i++ {
+		wg.Add(1)
 		go func() {
-			for u := range urlQueue {
-				pc := c.pageFetcher.FetchPage(u)
-				st.addPage(pc)
-				done := int(atomic.AddInt64(&st.processed, 1))
-				total := int(atomic.LoadInt64(&st.enqueued))
-				if done%c.config.ProgressEveryN == 0 {
-					c.eventHub.Publish(ProgressEvent{
-						Type:      "progress",
-						RequestID: requestID,
-						URL:       seed,
-						Done:      done, Total: total,
-						Percent:   utils.Percent(done, total),
-					})
-				}
-
-				if done >= st.maxPages {
-					c.eventHub.Publish(ProgressEvent{
-						Type:      "limit_reached",
-						RequestID: requestID,
-						URL:       seed,
-						Message:   fmt.Sprintf("Reached max crawl limit of %d pages", st.maxPages),
-					})
-					wg.Done()
+			defer wg.Done()
+			for {
+				if atomic.LoadInt64(&pending) <= 0 {
+					return
+				}
+				if ctx.Err() != nil {
+					// Cancelled: stop pulling more work. Whatever's left in
+					// pq is simply abandoned — there's no persistent state
+					// here worth preserving, unlike the frontier-backed path.
 					return
 				}
 
-				if pc.Error == "" && strings.HasPrefix(pc.ContentType, "text/html") {
-					for _, l := range ExtractSameDomainLinks(pc.HTML, u) {
-						enqueue(l)
+				link, host, ok := pq.popReady()
+				if !ok {
+					if pq.pending() > 0 {
+						c.eventHub.Publish(ProgressEvent{Type: "throttled", RequestID: requestID, URL: seed, Message: "waiting on per-host pacing/concurrency limits"})
 					}
+					time.Sleep(50 * time.Millisecond)
+					continue
+				}
+
+				links, limitReached := c.fetchAndIngest(ctx, requestID, seed, u, link, st, stream, spool, spoolOnce)
+				pq.release(host)
+				if limitReached {
+					atomic.AddInt64(&pending, -1)
+					return
+				}
+				for _, l := range links {
+					enqueue(l, false)
 				}
-				wg.Done()
+				atomic.AddInt64(&pending, -1)
 			}
 		}()
 	}
 
 	wg.Wait()
-	close(urlQueue)
-	st.sendSingleBatch(c.analyzerClient)
-	done := int(atomic.LoadInt64(&st.processed))
+}
+
+// crawlWithFrontier runs the crawl off a Frontier instead of a local queue, so
+// an in-flight crawl can be resumed by any instance after a restart. Workers
+// poll Pop rather than ranging over a channel, so completion is tracked with
+// a pending counter instead of channel closure: pending starts at the number
+// of urls already queued (including the seed, if this is a fresh crawl) and
+// is only decremented for a url after its newly discovered children have
+// been pushed, so it can never hit zero while work remains outstanding.
+func (c *Crawler) crawlWithFrontier(ctx context.Context, requestID, seed string, u *url.URL, st *crawlState, stream *BatchStream, spool **diskSpool, spoolOnce *sync.Once) {
+	remaining, err := c.frontier.Remaining(requestID, seed)
+	if err != nil {
+		log.Printf("[crawler:error] frontier unavailable for %s, falling back to an in-process queue: %v", requestID, err)
+		c.crawlWithLocalQueue(ctx, requestID, seed, u, st, stream, spool, spoolOnce)
+		return
+	}
+
+	if remaining == 0 {
+		// Fresh crawl (nothing left over from a previous attempt): seed the frontier.
+		if isNew, _ := c.frontier.MarkSeen(requestID, seed, seed); isNew {
+			if err := c.frontier.Push(requestID, seed, seed, 0); err != nil {
+				log.Printf("[crawler:error] failed to seed frontier for %s: %v", requestID, err)
+				return
+			}
+			atomic.AddInt64(&st.enqueued, 1)
+			remaining = 1
+		}
+	}
+	if remaining == 0 {
+		return
+	}
+	pending := remaining
+
+	enqueue := func(link string) {
+		link = NormalizeURL(st.mainURL, link)
+		if link == "" {
+			return
+		}
+		lu, err := url.Parse(link)
+		if err != nil || !utils.SameHost(st.mainHost, lu.Host) {
+			return
+		}
+		if c.config.RespectRobots && c.politeness != nil && !c.politeness.Allowed(link) {
+			c.eventHub.Publish(ProgressEvent{Type: "robots_blocked", RequestID: requestID, URL: link, Message: "disallowed by robots.txt"})
+			return
+		}
+		if int(atomic.LoadInt64(&st.enqueued)) >= st.maxPages {
+			return
+		}
+		isNew, err := c.frontier.MarkSeen(requestID, seed, link)
+		if err != nil || !isNew {
+			return
+		}
+		if err := c.frontier.Push(requestID, seed, link, 0); err != nil {
+			log.Printf("[crawler:error] failed to push %s onto frontier for %s: %v", link, requestID, err)
+			return
+		}
+		atomic.AddInt64(&st.enqueued, 1)
+		atomic.AddInt64(&pending, 1)
+	}
+
+	if c.config.RespectRobots && c.politeness != nil {
+		for _, sitemapURL := range c.politeness.Sitemaps(seed) {
+			for _, loc := range c.politeness.FetchSitemap(sitemapURL) {
+				enqueue(loc)
+			}
+		}
+	}
+
+	gates := newHostGateSet(c.config.HostConcurrency, c.config.DefaultCrawlDelay)
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.config.PerSeedWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if atomic.LoadInt64(&pending) <= 0 {
+					return
+				}
+				if ctx.Err() != nil {
+					// Cancelled: leave remaining frontier entries in place so
+					// the crawl can be resumed later instead of draining them.
+					return
+				}
+				if paused, _ := c.frontier.Paused(requestID); paused {
+					time.Sleep(500 * time.Millisecond)
+					continue
+				}
+
+				link, _, ok, err := c.frontier.Pop(requestID, seed)
+				if err != nil {
+					log.Printf("[crawler:error] frontier pop failed for %s: %v", requestID, err)
+					time.Sleep(200 * time.Millisecond)
+					continue
+				}
+				if !ok {
+					time.Sleep(50 * time.Millisecond)
+					continue
+				}
+
+				host := ""
+				if lu, err := url.Parse(link); err == nil {
+					host = strings.ToLower(lu.Host)
+				}
+				if host != "" && !gates.tryAcquire(host) {
+					// Host is at capacity or cooling down: put link back
+					// rather than drop it, and try another pop in the
+					// meantime — same backoff-and-retry shape popReady uses.
+					if err := c.frontier.Push(requestID, seed, link, 0); err != nil {
+						log.Printf("[crawler:error] failed to requeue %s onto frontier for %s: %v", link, requestID, err)
+					}
+					time.Sleep(50 * time.Millisecond)
+					continue
+				}
+
+				links, limitReached := c.fetchAndIngest(ctx, requestID, seed, u, link, st, stream, spool, spoolOnce)
+				if host != "" {
+					gates.release(host)
+				}
+				if limitReached {
+					atomic.AddInt64(&pending, -1)
+					return
+				}
+				for _, l := range links {
+					enqueue(l)
+				}
+				atomic.AddInt64(&pending, -1)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// fetchAndIngest fetches link, records it into st/stream/spool, publishes a
+// progress event, checkpoints the frontier (if any), and returns the
+// same-domain links discovered on the page. limitReached is true once
+// st.maxPages has been hit, telling the caller to stop pulling more work.
+func (c *Crawler) fetchAndIngest(ctx context.Context, requestID, seed string, u *url.URL, link string, st *crawlState, stream *BatchStream, spool **diskSpool, spoolOnce *sync.Once) (links []string, limitReached bool) {
+	if c.config.RespectRobots && c.politeness != nil {
+		c.politeness.Wait(link)
+	}
+	pc := c.transferManager.FetchPage(ctx, requestID, link)
+	if stream != nil {
+		// pc's HTML/headers go straight to the stream below; keeping only
+		// bookkeeping in st.pages is what actually bounds STREAM_UPLOAD's
+		// per-request memory to the crawl's URL count instead of its total
+		// page weight.
+		st.addPage(stripBody(pc))
+		if err := stream.WritePage(pc); err != nil {
+			spoolOnce.Do(func() {
+				log.Printf("[crawler:warning] analyzer stream write failed for %s, spooling remaining pages to disk: %v", requestID, err)
+				if s, serr := newDiskSpool(requestID); serr == nil {
+					*spool = s
+				} else {
+					log.Printf("[crawler:error] failed to open disk spool for %s: %v", requestID, serr)
+				}
+			})
+			if *spool != nil {
+				_ = (*spool).writePage(pc)
+			}
+		}
+	} else {
+		st.addPage(pc)
+	}
+
+	if c.frontier != nil {
+		if err := c.frontier.Checkpoint(requestID, seed, link); err != nil {
+			log.Printf("[crawler:warning] frontier checkpoint failed for %s: %v", requestID, err)
+		}
+	}
+
+	done := int(atomic.AddInt64(&st.processed, 1))
 	total := int(atomic.LoadInt64(&st.enqueued))
-	c.eventHub.Publish(ProgressEvent{
-		Type:      "complete",
-		RequestID: requestID,
-		URL:       seed,
-		Done:      done,
-		Total:     total,
-		Percent:   utils.Percent(done, total),
-	})
-	return nil
+	if done%c.config.ProgressEveryN == 0 {
+		c.eventHub.Publish(ProgressEvent{
+			Type:      "progress",
+			RequestID: requestID,
+			URL:       seed,
+			Done:      done, Total: total,
+			Percent:   utils.Percent(done, total),
+		})
+	}
+
+	if done >= st.maxPages {
+		c.eventHub.Publish(ProgressEvent{
+			Type:      "limit_reached",
+			RequestID: requestID,
+			URL:       seed,
+			Message:   fmt.Sprintf("Reached max crawl limit of %d pages", st.maxPages),
+		})
+		return nil, true
+	}
+
+	if pc.Error == "" && strings.HasPrefix(pc.ContentType, "text/html") {
+		links = ExtractSameDomainLinks(pc.HTML, u.String())
+	}
+	return links, false
+}
+
+// stripBody drops pc's HTML body and headers, keeping only the bookkeeping
+// fields (URL/status/error/content type) that crawlState needs once pc's
+// full content has already been handed off to a BatchStream.
+func stripBody(pc PageContent) PageContent {
+	pc.HTML = ""
+	pc.Headers = nil
+	return pc
 }
 
 // crawlState holds state during crawling
@@ -179,12 +509,28 @@ func (st *crawlState) addPage(pc PageContent) {
 	st.pagesMu.Unlock()
 }
 
-func (st *crawlState) sendSingleBatch(ac *AnalyzerClient) {
+// sendSingleBatch delivers everything fetched so far, regardless of whether
+// the crawl that gathered it was cancelled — cancellation stops new fetches,
+// it doesn't discard work already done — so delivery always runs with its own
+// background context rather than the (possibly already-cancelled) crawl ctx.
+func (st *crawlState) sendSingleBatch(ac *AnalyzerClient, archiveFormat string) {
 	st.pagesMu.Lock()
 	pagesCopy := make([]PageContent, len(st.pages))
 	copy(pagesCopy, st.pages)
 	st.pagesMu.Unlock()
 
+	if archiveFormat == "warc" {
+		// Streamed straight into the analyzer POST body by SendWARCBatch — no
+		// intermediate buffer or base64 string, unlike the zip path below.
+		batchID := uuid.New().String()
+		go func() {
+			if err := ac.SendWARCBatch(context.Background(), st.requestID, batchID, st.mainURL, pagesCopy); err != nil {
+				log.Printf("[crawler:error] WARC batch delivery failed for %s: %v", batchID, err)
+			}
+		}()
+		return
+	}
+
 	archive, metadata, stats, err := buildCompressedArchive(st.mainURL, pagesCopy)
 	if err != nil {
 		log.Printf("[crawler:error] failed to compress archive for %s: %v", st.mainURL, err)
@@ -205,8 +551,87 @@ func (st *crawlState) sendSingleBatch(ac *AnalyzerClient) {
 	}
 
 	go func(b PageBatch) {
-		if err := ac.SendBatch(b); err != nil {
+		if err := ac.SendBatch(context.Background(), b); err != nil {
 			log.Printf("[crawler:error] batch delivery failed for %s: %v", b.BatchID, err)
 		}
 	}(batch)
 }
+
+// resendSpooled replays pages that couldn't be written to a failed analyzer
+// stream and resends them as one ordinary buffered batch.
+func (st *crawlState) resendSpooled(ac *AnalyzerClient, spool *diskSpool, seed string) {
+	defer spool.close()
+
+	pages, err := spool.replay()
+	if err != nil {
+		log.Printf("[crawler:error] failed to replay disk spool for %s: %v", st.requestID, err)
+		return
+	}
+	if len(pages) == 0 {
+		return
+	}
+
+	log.Printf("[crawler:recover] resending %d spooled pages for %s via a buffered batch", len(pages), st.requestID)
+	batch := PageBatch{
+		RequestID:  st.requestID,
+		BatchID:    uuid.New().String(),
+		MainURL:    seed,
+		BatchNum:   1,
+		IsComplete: true,
+		TotalPages: len(pages),
+		Pages:      pages,
+	}
+
+	go func(b PageBatch) {
+		if err := ac.SendBatch(context.Background(), b); err != nil {
+			log.Printf("[crawler:error] spooled batch delivery failed for %s: %v", b.BatchID, err)
+		}
+	}(batch)
+}
+
+// diskSpool buffers pages that a broken analyzer stream can no longer accept,
+// so STREAM_UPLOAD mode can still recover the tail of a crawl via a normal batch send.
+type diskSpool struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+func newDiskSpool(requestID string) (*diskSpool, error) {
+	f, err := os.CreateTemp("", fmt.Sprintf("batch-%s-*.ndjson", requestID))
+	if err != nil {
+		return nil, err
+	}
+	return &diskSpool{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (ds *diskSpool) writePage(pc PageContent) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	return ds.enc.Encode(pc)
+}
+
+func (ds *diskSpool) replay() ([]PageContent, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if _, err := ds.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var pages []PageContent
+	dec := json.NewDecoder(ds.file)
+	for dec.More() {
+		var pc PageContent
+		if err := dec.Decode(&pc); err != nil {
+			return pages, err
+		}
+		pages = append(pages, pc)
+	}
+	return pages, nil
+}
+
+func (ds *diskSpool) close() {
+	_ = ds.file.Close()
+	_ = os.Remove(ds.file.Name())
+}
@@ -7,33 +7,48 @@ import (
 	"time"
 
 	"github.com/redis/go-redis/v9"
+
+	"go-fetcher/lib/transport"
 )
 
 // FailedBatch represents a batch that failed to be delivered to analyzer
 type FailedBatch struct {
-	RequestID  string      `json:"request_id"`
-	MainURL    string      `json:"main_url"`
-	BatchNum   int         `json:"batch_num"`
-	Pages      []PageContent `json:"pages"`
-	Error      string      `json:"error"`
-	Timestamp  time.Time   `json:"timestamp"`
-	RetryCount int         `json:"retry_count"`
+	RequestID    string        `json:"request_id"`
+	MainURL      string        `json:"main_url"`
+	BatchNum     int           `json:"batch_num"`
+	Pages        []PageContent `json:"pages"`
+	Error        string        `json:"error"`
+	Timestamp    time.Time     `json:"timestamp"`
+	RetryCount   int           `json:"retry_count"`
+	NextRetryAt  time.Time     `json:"next_retry_at"`
 }
 
 // DeadLetterQueue manages failed batch delivery
 type DeadLetterQueue struct {
 	redisClient *redis.Client
 	queueName   string
+
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	multiplier  float64
+	maxRetries  int
 }
 
-// NewDeadLetterQueue creates a new DLQ instance
-func NewDeadLetterQueue(redisClient *redis.Client, queueName string) *DeadLetterQueue {
+// NewDeadLetterQueue creates a new DLQ instance. baseBackoff/maxBackoff/
+// multiplier control the exponential-backoff-with-jitter delay (see
+// transport.Backoff) applied before a failed batch is retried again;
+// maxRetries is how many times a batch is redelivered before it's dropped.
+func NewDeadLetterQueue(redisClient *redis.Client, queueName string, baseBackoff, maxBackoff time.Duration, multiplier float64, maxRetries int) *DeadLetterQueue {
 	if queueName == "" {
 		queueName = "dlq:failed-batches"
 	}
 	return &DeadLetterQueue{
 		redisClient: redisClient,
 		queueName:   queueName,
+		baseBackoff: baseBackoff,
+		maxBackoff:  maxBackoff,
+		multiplier:  multiplier,
+		maxRetries:  maxRetries,
 	}
 }
 
@@ -117,9 +132,15 @@ func (dlq *DeadLetterQueue) Stats() map[string]interface{} {
 	}
 }
 
-// RetryFailedBatches attempts to retry all failed batches
+// RetryFailedBatches makes one pass over the batches currently in the queue,
+// retrying each that's due (NextRetryAt has elapsed) and pushing back any
+// that aren't ready yet or that fail again. It's bounded to the queue's
+// length at the start of the call so a batch that gets re-queued can't be
+// picked up again in the same pass — it waits for the worker's next tick.
 func (dlq *DeadLetterQueue) RetryFailedBatches(ac *AnalyzerClient) error {
-	for {
+	toProcess := dlq.Length()
+
+	for i := int64(0); i < toProcess; i++ {
 		batch, err := dlq.Dequeue()
 		if err != nil {
 			return err
@@ -128,6 +149,11 @@ func (dlq *DeadLetterQueue) RetryFailedBatches(ac *AnalyzerClient) error {
 			break // Queue is empty
 		}
 
+		if !batch.NextRetryAt.IsZero() && time.Now().Before(batch.NextRetryAt) {
+			dlq.Enqueue(*batch) // not due yet, leave it for a later pass
+			continue
+		}
+
 		// Convert back to PageBatch for sending
 		pageBatch := PageBatch{
 			RequestID:  batch.RequestID,
@@ -139,16 +165,18 @@ func (dlq *DeadLetterQueue) RetryFailedBatches(ac *AnalyzerClient) error {
 
 		log.Printf("[dlq:retry] Retrying batch %s (attempt %d)", batch.RequestID, batch.RetryCount+1)
 
-		err = ac.SendBatch(pageBatch)
+		err = ac.SendBatch(context.Background(), pageBatch)
 		if err != nil {
 			// Still failing - re-queue with incremented counter
 			batch.RetryCount++
 			batch.Error = err.Error()
 			batch.Timestamp = time.Now()
 
-			if batch.RetryCount < 5 { // Max 5 retries
+			if batch.RetryCount < dlq.maxRetries {
+				backoff := transport.Backoff(batch.RetryCount, dlq.baseBackoff, dlq.maxBackoff, dlq.multiplier)
+				batch.NextRetryAt = time.Now().Add(backoff)
 				dlq.Enqueue(*batch)
-				log.Printf("[dlq:requeue] Batch %s re-queued (retry_count=%d)", batch.RequestID, batch.RetryCount)
+				log.Printf("[dlq:requeue] Batch %s re-queued (retry_count=%d, next_retry_in=%v)", batch.RequestID, batch.RetryCount, backoff)
 			} else {
 				log.Printf("[dlq:failed] Batch %s exceeded max retries", batch.RequestID)
 			}
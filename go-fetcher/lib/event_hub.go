@@ -1,19 +1,53 @@
 package lib
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
 	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
 )
 
+// StreamedEvent pairs a ProgressEvent with the ID it was (or will be)
+// persisted under in its request's Redis Stream, so the SSE handler can set
+// the id: field and a reconnecting browser can resume via Last-Event-ID.
+type StreamedEvent struct {
+	ID    string
+	Event ProgressEvent
+}
+
 // Subscriber represents a client subscribed to events
 type Subscriber struct {
-	ch   chan ProgressEvent
+	ch   chan StreamedEvent
 	done chan struct{}
 }
 
-// EventHub manages SSE subscriptions
+// writebackIdleTimeout is how long a requestID's writeback worker waits with
+// nothing to send before retiring, so EventHub doesn't keep one goroutine
+// alive forever for every requestID it's ever published for.
+const writebackIdleTimeout = 30 * time.Second
+
+// EventHub manages SSE subscriptions. Publish always fans events out to
+// in-memory subscribers immediately; if SetRedis has been called it also
+// hands each event to a per-requestID writeback worker that persists it to a
+// Redis Stream, so SubscribeFrom can replay history to a subscriber that
+// missed it.
 type EventHub struct {
 	mu        sync.RWMutex
 	requestCh map[string]map[*Subscriber]struct{} // "" = global subscribers
+
+	redisClient  *redis.Client // optional; nil disables writeback and replay
+	streamTTL    time.Duration
+	streamMaxLen int64
+
+	idMu    sync.Mutex
+	lastMs  int64
+	lastSeq int64
+
+	writebackQueues sync.Map // requestID -> chan StreamedEvent, see Publish/writebackWorker
 }
 
 // NewEventHub creates a new event hub
@@ -21,11 +55,22 @@ func NewEventHub() *EventHub {
 	return &EventHub{requestCh: make(map[string]map[*Subscriber]struct{})}
 }
 
+// SetRedis enables persisting published events to a per-request Redis Stream
+// (events:{request_id}), trimmed to roughly maxLen entries and expiring after
+// ttl — matching the DLQ's 30-day window — so SubscribeFrom can replay
+// history to a reconnecting browser. Pass a nil redisClient to keep EventHub
+// in-memory only.
+func (h *EventHub) SetRedis(redisClient *redis.Client, ttl time.Duration, maxLen int64) {
+	h.redisClient = redisClient
+	h.streamTTL = ttl
+	h.streamMaxLen = maxLen
+}
+
 // Subscribe adds a subscriber to the hub
 func (h *EventHub) Subscribe(requestID string) *Subscriber {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	s := &Subscriber{ch: make(chan ProgressEvent, 256), done: make(chan struct{})}
+	s := &Subscriber{ch: make(chan StreamedEvent, 256), done: make(chan struct{})}
 	if _, ok := h.requestCh[requestID]; !ok {
 		h.requestCh[requestID] = make(map[*Subscriber]struct{})
 	}
@@ -33,6 +78,46 @@ func (h *EventHub) Subscribe(requestID string) *Subscriber {
 	return s
 }
 
+// SubscribeFrom subscribes to requestID's live events the same way Subscribe
+// does, then queues the events persisted in its Redis Stream after lastEventID
+// (exclusive) onto the same channel, so a browser reconnecting with
+// Last-Event-ID gets what was published while it was disconnected. The live
+// subscription is registered before the replay is read, so live events can
+// arrive ahead of replayed ones or be delivered twice; events whose async
+// writeback hasn't landed yet are not replayed, and replayed events that don't
+// fit the subscriber's buffer are dropped. lastEventID == "" behaves exactly
+// like Subscribe. Falls back to a live-only subscription if Redis is
+// unavailable or the replay itself fails.
+func (h *EventHub) SubscribeFrom(requestID, lastEventID string) *Subscriber {
+	s := h.Subscribe(requestID)
+	if h.redisClient == nil || lastEventID == "" || requestID == "" {
+		return s
+	}
+
+	entries, err := h.redisClient.XRange(context.Background(), streamKey(requestID), "("+lastEventID, "+").Result()
+	if err != nil {
+		log.Printf("[event_hub:warning] failed to replay history for %s from %s: %v", requestID, lastEventID, err)
+		return s
+	}
+
+	for _, entry := range entries {
+		raw, ok := entry.Values["data"].(string)
+		if !ok {
+			continue
+		}
+		var ev ProgressEvent
+		if err := json.Unmarshal([]byte(raw), &ev); err != nil {
+			continue
+		}
+		select {
+		case s.ch <- StreamedEvent{ID: entry.ID, Event: ev}:
+		default: // subscriber's replay buffer is full; drop the rest rather than block
+		}
+	}
+
+	return s
+}
+
 // Unsubscribe removes a subscriber from the hub
 func (h *EventHub) Unsubscribe(requestID string, s *Subscriber) {
 	h.mu.Lock()
@@ -47,19 +132,138 @@ func (h *EventHub) Unsubscribe(requestID string, s *Subscriber) {
 	}
 }
 
-// Publish sends an event to all subscribers
+// Publish sends an event to all subscribers and, if Redis is configured,
+// hands it to ev.RequestID's writeback worker to persist in Stream order.
 func (h *EventHub) Publish(ev ProgressEvent) {
+	se := h.assignAndEnqueue(ev)
+
 	h.mu.RLock()
-	defer h.mu.RUnlock()
 	for _, subs := range []map[*Subscriber]struct{}{
 		h.requestCh[""], // global
 		h.requestCh[ev.RequestID],
 	} {
 		for s := range subs {
 			select {
-			case s.ch <- ev:
+			case s.ch <- se:
 			default: // drop if slow
 			}
 		}
 	}
+	h.mu.RUnlock()
+}
+
+// assignAndEnqueue generates ev's stream ID and, if Redis is configured,
+// hands it to ev.RequestID's writeback worker — both under idMu, so two
+// concurrent Publish calls for the same request always enqueue in the same
+// order their IDs were handed out in. Without that guarantee, a worker's
+// XAdd (which requires each stream's ID to strictly increase) could see a
+// smaller ID arrive after a larger one already landed and get silently
+// rejected, leaving a gap in the replay history.
+func (h *EventHub) assignAndEnqueue(ev ProgressEvent) StreamedEvent {
+	h.idMu.Lock()
+	defer h.idMu.Unlock()
+
+	se := StreamedEvent{ID: h.nextIDLocked(), Event: ev}
+	if h.redisClient != nil && ev.RequestID != "" {
+		h.enqueueWriteback(se)
+	}
+	return se
+}
+
+// enqueueWriteback hands se to ev.RequestID's single writeback worker,
+// starting one lazily on first use. Must be called with idMu held (see
+// assignAndEnqueue) so sends for a given requestID land in ID order.
+func (h *EventHub) enqueueWriteback(se StreamedEvent) {
+	requestID := se.Event.RequestID
+	v, loaded := h.writebackQueues.LoadOrStore(requestID, make(chan StreamedEvent, 256))
+	q := v.(chan StreamedEvent)
+	if !loaded {
+		go h.writebackWorker(requestID, q)
+	}
+	select {
+	case q <- se:
+	default: // worker can't keep up; drop rather than block Publish
+		log.Printf("[event_hub:warning] writeback queue full for %s, dropping event %s", requestID, se.ID)
+	}
+}
+
+// writebackWorker persists every event enqueued for requestID to its Redis
+// Stream one at a time, in the order Publish enqueued them, so XAdd's
+// explicit IDs are always increasing for that stream. It retires itself
+// after writebackIdleTimeout of inactivity, and only with idMu held and q
+// empty, so no Publish call can be handing it a fresh event at that moment.
+func (h *EventHub) writebackWorker(requestID string, q chan StreamedEvent) {
+	idle := time.NewTimer(writebackIdleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case se := <-q:
+			h.writeback(se)
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(writebackIdleTimeout)
+		case <-idle.C:
+			h.idMu.Lock()
+			if len(q) == 0 {
+				h.writebackQueues.Delete(requestID)
+				h.idMu.Unlock()
+				return
+			}
+			h.idMu.Unlock()
+			idle.Reset(writebackIdleTimeout)
+		}
+	}
+}
+
+// writeback persists se to ev.RequestID's Redis Stream under the same ID it
+// was just fanned out to live subscribers under, so live and replayed events
+// share one consistent ID space. Called only from se's requestID's single
+// writeback worker, never concurrently with itself.
+func (h *EventHub) writeback(se StreamedEvent) {
+	data, err := json.Marshal(se.Event)
+	if err != nil {
+		log.Printf("[event_hub:error] failed to marshal event for %s: %v", se.Event.RequestID, err)
+		return
+	}
+
+	ctx := context.Background()
+	key := streamKey(se.Event.RequestID)
+	_, err = h.redisClient.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		ID:     se.ID,
+		MaxLen: h.streamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"data": data},
+	}).Result()
+	if err != nil {
+		log.Printf("[event_hub:warning] failed to persist event %s for %s: %v", se.ID, se.Event.RequestID, err)
+		return
+	}
+
+	if err := h.redisClient.Expire(ctx, key, h.streamTTL).Err(); err != nil {
+		log.Printf("[event_hub:warning] failed to set TTL on %s: %v", key, err)
+	}
+}
+
+// nextIDLocked generates a Redis-Stream-shaped "<ms>-<seq>" ID, matching the
+// format XADD would assign itself with "*". Generating it here (rather than
+// letting XAdd pick one) lets Publish hand the same ID to live subscribers
+// and the asynchronous Redis write, so replay picks up exactly where live
+// delivery left off instead of the two ID spaces drifting apart. Caller must
+// hold idMu (see assignAndEnqueue).
+func (h *EventHub) nextIDLocked() string {
+	ms := time.Now().UnixMilli()
+	if ms <= h.lastMs {
+		ms = h.lastMs
+		h.lastSeq++
+	} else {
+		h.lastMs = ms
+		h.lastSeq = 0
+	}
+	return fmt.Sprintf("%d-%d", ms, h.lastSeq)
+}
+
+func streamKey(requestID string) string {
+	return "events:" + requestID
 }
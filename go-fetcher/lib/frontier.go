@@ -0,0 +1,145 @@
+package lib
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Frontier is a crawl's URL queue and seen-set, scoped per (requestID, seed)
+// since StartCrawl runs one goroutine per seed URL in a request and each
+// needs its own queue/seen-set/cursor — sharing one across seeds would let a
+// link discovered under one seed get popped and processed under another
+// seed's crawlState. Unlike keeping these in a local channel and map, an
+// implementation backed by external storage lets a crawl survive a process
+// restart and lets multiple go-fetcher instances share the same in-flight
+// crawl. Pause/Resume/Paused are the exception: they gate the whole request
+// (every seed) at once, matching the dashboard's pause/resume endpoints.
+type Frontier interface {
+	// Push enqueues url at depth for (requestID, seed). Re-pushing an
+	// already-seen url is harmless; callers should still gate pushes with
+	// MarkSeen to avoid unbounded queue growth on cyclic link graphs.
+	Push(requestID, seed, url string, depth int) error
+	// Pop removes and returns the lowest-depth url for (requestID, seed). ok
+	// is false when the queue is currently empty.
+	Pop(requestID, seed string) (url string, depth int, ok bool, err error)
+	// MarkSeen records url as visited for (requestID, seed), returning true
+	// the first time it's seen and false on every subsequent call.
+	MarkSeen(requestID, seed, url string) (bool, error)
+	// Remaining reports how many urls are currently queued for (requestID, seed).
+	Remaining(requestID, seed string) (int64, error)
+	// Checkpoint records a resume cursor for (requestID, seed), e.g. the most
+	// recently completed url, so a dashboard or resumed worker can tell how
+	// far that seed's crawl got.
+	Checkpoint(requestID, seed, cursor string) error
+	// Pause/Resume/Paused implement the pause flag workers poll between
+	// pages, shared by every seed in requestID.
+	Pause(requestID string) error
+	Resume(requestID string) error
+	Paused(requestID string) (bool, error)
+}
+
+// RedisFrontier implements Frontier on top of Redis: a per-(request, seed)
+// sorted set (score = depth) for the queue and a per-(request, seed) SET for
+// the seen-set, all under a frontier:{request_id}:{seed_hash}:* namespace
+// that expires after ttl of inactivity so an abandoned crawl's keys don't
+// leak forever.
+type RedisFrontier struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisFrontier creates a frontier whose keys expire after ttl of
+// inactivity (refreshed on every write).
+func NewRedisFrontier(client *redis.Client, ttl time.Duration) *RedisFrontier {
+	return &RedisFrontier{client: client, ttl: ttl}
+}
+
+// scope identifies one seed's frontier within requestID. seed is hashed
+// rather than used raw since it can contain ':' and other characters that
+// would otherwise make the key structure ambiguous.
+func (f *RedisFrontier) scope(requestID, seed string) string {
+	sum := sha1.Sum([]byte(seed))
+	return fmt.Sprintf("%s:%s", requestID, hex.EncodeToString(sum[:])[:12])
+}
+
+func (f *RedisFrontier) queueKey(requestID, seed string) string {
+	return fmt.Sprintf("frontier:%s:queue", f.scope(requestID, seed))
+}
+func (f *RedisFrontier) seenKey(requestID, seed string) string {
+	return fmt.Sprintf("frontier:%s:seen", f.scope(requestID, seed))
+}
+func (f *RedisFrontier) cursorKey(requestID, seed string) string {
+	return fmt.Sprintf("frontier:%s:cursor", f.scope(requestID, seed))
+}
+func (f *RedisFrontier) pausedKey(requestID string) string { return fmt.Sprintf("frontier:%s:paused", requestID) }
+
+func (f *RedisFrontier) Push(requestID, seed, url string, depth int) error {
+	ctx := context.Background()
+	key := f.queueKey(requestID, seed)
+	if err := f.client.ZAdd(ctx, key, redis.Z{Score: float64(depth), Member: url}).Err(); err != nil {
+		return fmt.Errorf("frontier push: %w", err)
+	}
+	f.client.Expire(ctx, key, f.ttl)
+	return nil
+}
+
+func (f *RedisFrontier) Pop(requestID, seed string) (string, int, bool, error) {
+	ctx := context.Background()
+	res, err := f.client.ZPopMin(ctx, f.queueKey(requestID, seed), 1).Result()
+	if err != nil {
+		return "", 0, false, fmt.Errorf("frontier pop: %w", err)
+	}
+	if len(res) == 0 {
+		return "", 0, false, nil
+	}
+	url, _ := res[0].Member.(string)
+	return url, int(res[0].Score), true, nil
+}
+
+func (f *RedisFrontier) MarkSeen(requestID, seed, url string) (bool, error) {
+	ctx := context.Background()
+	key := f.seenKey(requestID, seed)
+	added, err := f.client.SAdd(ctx, key, url).Result()
+	if err != nil {
+		return false, fmt.Errorf("frontier mark seen: %w", err)
+	}
+	f.client.Expire(ctx, key, f.ttl)
+	return added > 0, nil
+}
+
+func (f *RedisFrontier) Remaining(requestID, seed string) (int64, error) {
+	n, err := f.client.ZCard(context.Background(), f.queueKey(requestID, seed)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("frontier remaining: %w", err)
+	}
+	return n, nil
+}
+
+func (f *RedisFrontier) Checkpoint(requestID, seed, cursor string) error {
+	key := f.cursorKey(requestID, seed)
+	if err := f.client.Set(context.Background(), key, cursor, f.ttl).Err(); err != nil {
+		return fmt.Errorf("frontier checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (f *RedisFrontier) Pause(requestID string) error {
+	return f.client.Set(context.Background(), f.pausedKey(requestID), "1", f.ttl).Err()
+}
+
+func (f *RedisFrontier) Resume(requestID string) error {
+	return f.client.Del(context.Background(), f.pausedKey(requestID)).Err()
+}
+
+func (f *RedisFrontier) Paused(requestID string) (bool, error) {
+	n, err := f.client.Exists(context.Background(), f.pausedKey(requestID)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -2,22 +2,45 @@ package lib
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"go-fetcher/lib/recorder"
+	"go-fetcher/lib/transport"
 )
 
+const activeCrawlsKey = "crawls:active"
+
 // Handler contains HTTP handlers
 type Handler struct {
 	crawler        *Crawler
 	eventHub       *EventHub
 	semaphore      chan struct{}
 	activeRequests sync.Map
+	recorder       recorder.Recorder
+	transports     map[string]*transport.RoundTripper
+
+	redisClient   *redis.Client // optional; nil disables the crawls:active registry and pause/resume
+	frontier      Frontier      // optional; nil disables pause/resume (no frontier to flag)
+	leaseTTL      time.Duration
+}
+
+// activeCrawlEntry is stored as the crawls:active hash value for requestID,
+// so a restarted instance can tell which crawls were still running and
+// resume any whose lease has lapsed (see Handler.ResumeExpired).
+type activeCrawlEntry struct {
+	Urls            []string  `json:"urls"`
+	StartedAt       time.Time `json:"started_at"`
+	LeaseExpiresAt  time.Time `json:"lease_expires_at"`
 }
 
 // NewHandler creates a new handler
@@ -29,6 +52,29 @@ func NewHandler(crawler *Crawler, eventHub *EventHub, maxConcurrent int) *Handle
 	}
 }
 
+// SetRecorder enables per-crawl recording of upstream fetches and the analyzer
+// upload, and the forced-on /debug/record/{request_id} endpoint. Pass nil to disable.
+func (h *Handler) SetRecorder(r recorder.Recorder) {
+	h.recorder = r
+}
+
+// SetTransports registers the named RoundTrippers (e.g. "crawl", "analyzer")
+// exposed via GET /transport/stats. Pass nil/empty to disable the endpoint.
+func (h *Handler) SetTransports(transports map[string]*transport.RoundTripper) {
+	h.transports = transports
+}
+
+// SetActiveRegistry enables the crawls:active Redis hash (so a restarted
+// instance can resume crawls that were still running) and the pause/resume
+// endpoints, which flip a flag on frontier. leaseTTL controls how long a
+// crawl can go without its lease being renewed before ResumeExpired treats
+// its owner as dead. Pass a nil redisClient or frontier to disable.
+func (h *Handler) SetActiveRegistry(redisClient *redis.Client, frontier Frontier, leaseTTL time.Duration) {
+	h.redisClient = redisClient
+	h.frontier = frontier
+	h.leaseTTL = leaseTTL
+}
+
 type ActiveRequest struct {
 	RequestID string    `json:"request_id"`
 	StartedAt time.Time `json:"started_at"`
@@ -50,22 +96,187 @@ func (h *Handler) HandleFetch(w http.ResponseWriter, r *http.Request) {
 	}
 
 	requestID := uuid.NewString()
+	h.startCrawl(requestID, req)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":     "started",
+		"request_id": requestID,
+	})
+}
+
+// startCrawl registers requestID in the active-crawl bookkeeping (in-memory,
+// and crawls:active in Redis if SetActiveRegistry was called) and runs the
+// crawl in the background.
+func (h *Handler) startCrawl(requestID string, req FetchRequest) {
 	h.activeRequests.Store(requestID, ActiveRequest{
 		RequestID: requestID,
 		StartedAt: time.Now().UTC(),
 		UrlCount:  len(req.Urls),
 	})
 
+	stopLease := h.registerActive(requestID, req)
+
 	go func() {
 		h.semaphore <- struct{}{}
 		defer func() { <-h.semaphore }()
-		h.crawler.StartCrawl(requestID, req.Urls)
+		h.crawler.StartCrawl(context.Background(), requestID, req.Urls)
 		h.activeRequests.Delete(requestID)
+		if stopLease != nil {
+			stopLease()
+		}
+		h.deregisterActive(requestID)
+
+		if h.recorder != nil {
+			if path, err := h.recorder.Finalize(requestID, req); err != nil {
+				log.Printf("[handler:recorder:error] failed to finalize recording for %s: %v", requestID, err)
+			} else if path != "" {
+				log.Printf("[handler:recorder] wrote recording for %s to %s", requestID, path)
+			}
+		}
 	}()
+}
+
+// registerActive writes requestID into crawls:active with a lease and starts
+// a goroutine that renews the lease every leaseTTL/2 until the returned stop
+// func is called. Returns nil if the active registry is disabled.
+func (h *Handler) registerActive(requestID string, req FetchRequest) func() {
+	if h.redisClient == nil {
+		return nil
+	}
+
+	renew := func() error {
+		entry := activeCrawlEntry{
+			Urls:           req.Urls,
+			StartedAt:      time.Now().UTC(),
+			LeaseExpiresAt: time.Now().UTC().Add(h.leaseTTL),
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return h.redisClient.HSet(context.Background(), activeCrawlsKey, requestID, data).Err()
+	}
+
+	if err := renew(); err != nil {
+		log.Printf("[handler:active:error] failed to register %s in %s: %v", requestID, activeCrawlsKey, err)
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(h.leaseTTL / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := renew(); err != nil {
+					log.Printf("[handler:active:error] failed to renew lease for %s: %v", requestID, err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(stop) }) }
+}
+
+func (h *Handler) deregisterActive(requestID string) {
+	if h.redisClient == nil {
+		return
+	}
+	if err := h.redisClient.HDel(context.Background(), activeCrawlsKey, requestID).Err(); err != nil {
+		log.Printf("[handler:active:error] failed to remove %s from %s: %v", requestID, activeCrawlsKey, err)
+	}
+}
+
+// ResumeExpired scans crawls:active for entries whose lease has lapsed —
+// meaning the instance that owned them is presumed dead — and restarts them
+// on this instance. The frontier already has their queued urls and seen-set,
+// so StartCrawl picks up roughly where the dead owner left off.
+func (h *Handler) ResumeExpired() {
+	if h.redisClient == nil {
+		return
+	}
+
+	entries, err := h.redisClient.HGetAll(context.Background(), activeCrawlsKey).Result()
+	if err != nil {
+		log.Printf("[handler:resume:error] failed to scan %s: %v", activeCrawlsKey, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	for requestID, raw := range entries {
+		var entry activeCrawlEntry
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+			log.Printf("[handler:resume:error] skipping unparseable %s entry for %s: %v", activeCrawlsKey, requestID, err)
+			continue
+		}
+		if now.Before(entry.LeaseExpiresAt) {
+			continue // owner is still renewing its lease
+		}
+
+		log.Printf("[handler:resume] resuming %s (%d urls), lease expired at %s", requestID, len(entry.Urls), entry.LeaseExpiresAt)
+		h.startCrawl(requestID, FetchRequest{Urls: entry.Urls})
+	}
+}
+
+// HandleFetchControl handles POST /fetch/{request_id}/pause, .../resume, and
+// .../cancel. pause/resume flip the frontier's pause flag that
+// crawlWithFrontier's workers poll between pages; cancel stops the crawl's
+// workers outright via Crawler.Cancel and doesn't require a frontier.
+func (h *Handler) HandleFetchControl(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/fetch/")
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 || parts[0] == "" {
+		http.Error(w, "expected /fetch/{request_id}/pause|resume|cancel", http.StatusBadRequest)
+		return
+	}
+	requestID, action := parts[0], parts[1]
+
+	if action == "cancel" {
+		if !h.crawler.Cancel(requestID) {
+			http.Error(w, "no running crawl for that request_id", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"status":     "cancelled",
+			"request_id": requestID,
+		})
+		return
+	}
+
+	if h.frontier == nil {
+		http.Error(w, "pause/resume requires a frontier", http.StatusServiceUnavailable)
+		return
+	}
+
+	var err error
+	switch action {
+	case "pause":
+		err = h.frontier.Pause(requestID)
+	case "resume":
+		err = h.frontier.Resume(requestID)
+	default:
+		http.Error(w, "expected /fetch/{request_id}/pause|resume|cancel", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[handler:control:error] %s %s failed: %v", action, requestID, err)
+		http.Error(w, "failed to update frontier", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
-		"status":     "started",
+		"status":     action + "d",
 		"request_id": requestID,
 	})
 }
@@ -85,7 +296,10 @@ func (h *Handler) HandleSSEByRequest(w http.ResponseWriter, r *http.Request) {
 	h.streamSSE(w, r, id)
 }
 
-// streamSSE streams SSE events
+// streamSSE streams SSE events. It honors the standard Last-Event-ID request
+// header (set by browsers auto-reconnecting an SSE stream) by replaying
+// everything published for requestID since that ID before joining the live
+// fan-out; see EventHub.SubscribeFrom.
 func (h *Handler) streamSSE(w http.ResponseWriter, r *http.Request, requestID string) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -97,7 +311,12 @@ func (h *Handler) streamSSE(w http.ResponseWriter, r *http.Request, requestID st
 		return
 	}
 
-	sub := h.eventHub.Subscribe(requestID)
+	var sub *Subscriber
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		sub = h.eventHub.SubscribeFrom(requestID, lastEventID)
+	} else {
+		sub = h.eventHub.Subscribe(requestID)
+	}
 	defer h.eventHub.Unsubscribe(requestID, sub)
 
 	bw := bufio.NewWriter(w)
@@ -109,15 +328,66 @@ func (h *Handler) streamSSE(w http.ResponseWriter, r *http.Request, requestID st
 		select {
 		case <-r.Context().Done():
 			return
-		case ev := <-sub.ch:
-			data, _ := json.Marshal(ev)
-			fmt.Fprintf(bw, "event: %s\ndata: %s\n\n", ev.Type, data)
+		case se := <-sub.ch:
+			data, _ := json.Marshal(se.Event)
+			fmt.Fprintf(bw, "id: %s\nevent: %s\ndata: %s\n\n", se.ID, se.Event.Type, data)
 			bw.Flush()
 			flusher.Flush()
 		}
 	}
 }
 
+// HandleDebugRecord forces full recording of request_id's crawl regardless of
+// the configured sampling rate, so a crawl that is about to be retried or is
+// misbehaving can be captured for replay.
+func (h *Handler) HandleDebugRecord(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	requestID := strings.TrimPrefix(r.URL.Path, "/debug/record/")
+	if requestID == "" {
+		http.Error(w, "missing request_id", http.StatusBadRequest)
+		return
+	}
+
+	if h.recorder == nil {
+		http.Error(w, "recording is disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	h.recorder.Force(requestID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":     "recording",
+		"request_id": requestID,
+	})
+}
+
+// HandleTransportStats returns per-host retry/circuit-breaker stats for each
+// registered transport (see SetTransports), keyed by transport name then host.
+func (h *Handler) HandleTransportStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if len(h.transports) == 0 {
+		http.Error(w, "transport stats unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	out := make(map[string]map[string]transport.HostStats, len(h.transports))
+	for name, rt := range h.transports {
+		out[name] = rt.Stats()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
 // HandleActiveRequests returns the currently running requests
 func (h *Handler) HandleActiveRequests(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
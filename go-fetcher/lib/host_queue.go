@@ -0,0 +1,207 @@
+package lib
+
+import (
+	"container/heap"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// queueItem is one pending URL in a hostPriorityQueue, ordered by score
+// (lower runs first).
+type queueItem struct {
+	link  string
+	host  string
+	score int
+	index int
+}
+
+// itemHeap implements container/heap.Interface over queueItem, giving
+// hostPriorityQueue an O(log n) pop-lowest-score operation.
+type itemHeap []*queueItem
+
+func (h itemHeap) Len() int            { return len(h) }
+func (h itemHeap) Less(i, j int) bool  { return h[i].score < h[j].score }
+func (h itemHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *itemHeap) Push(x any) {
+	it := x.(*queueItem)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+func (h *itemHeap) Pop() any {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	it.index = -1
+	*h = old[:n-1]
+	return it
+}
+
+// hostGate is the token bucket one host is throttled through: at most
+// maxInFlight fetches running concurrently, and at least minDelay between
+// starting consecutive fetches.
+type hostGate struct {
+	maxInFlight int
+	minDelay    time.Duration
+	inFlight    int
+	nextAllowed time.Time
+}
+
+func (g *hostGate) ready(now time.Time) bool {
+	return g.inFlight < g.maxInFlight && !now.Before(g.nextAllowed)
+}
+
+func (g *hostGate) acquire(now time.Time) {
+	g.inFlight++
+	g.nextAllowed = now.Add(g.minDelay)
+}
+
+func (g *hostGate) release() {
+	g.inFlight--
+}
+
+// hostGateSet tracks one hostGate per host, shared by any queueing strategy
+// that wants per-host concurrency/delay throttling — hostPriorityQueue
+// (crawlWithLocalQueue) and crawlWithFrontier both gate through one of these
+// rather than each rolling their own.
+type hostGateSet struct {
+	mu          sync.Mutex
+	gates       map[string]*hostGate
+	maxInFlight int
+	minDelay    time.Duration
+}
+
+// newHostGateSet creates a set of host gates, each allowing at most
+// maxInFlight concurrent fetches at least minDelay apart.
+func newHostGateSet(maxInFlight int, minDelay time.Duration) *hostGateSet {
+	if maxInFlight < 1 {
+		maxInFlight = 1
+	}
+	return &hostGateSet{gates: make(map[string]*hostGate), maxInFlight: maxInFlight, minDelay: minDelay}
+}
+
+func (s *hostGateSet) gateFor(host string) *hostGate {
+	g, ok := s.gates[host]
+	if !ok {
+		g = &hostGate{maxInFlight: s.maxInFlight, minDelay: s.minDelay}
+		s.gates[host] = g
+	}
+	return g
+}
+
+// tryAcquire acquires host's gate and returns true if it currently has
+// in-flight/delay headroom, or false (no-op) if host is at capacity or
+// cooling down, in which case the caller should back off and retry later.
+func (s *hostGateSet) tryAcquire(host string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.gateFor(host)
+	if !g.ready(time.Now()) {
+		return false
+	}
+	g.acquire(time.Now())
+	return true
+}
+
+// release returns host's in-flight slot after a fetch completes.
+func (s *hostGateSet) release(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if g, ok := s.gates[host]; ok {
+		g.release()
+	}
+}
+
+// hostPriorityQueue is the per-seed URL queue crawlWithLocalQueue pulls work
+// from: a single priority queue ordered by score (see linkScore), gated per
+// host by a hostGateSet so a worker blocks on a host that's cooling down or at
+// capacity instead of skipping it and starving it of further requests.
+type hostPriorityQueue struct {
+	mu    sync.Mutex
+	items itemHeap
+	gates *hostGateSet
+}
+
+// newHostPriorityQueue creates an empty queue gating each host to at most
+// maxInFlight concurrent fetches, at least minDelay apart.
+func newHostPriorityQueue(maxInFlight int, minDelay time.Duration) *hostPriorityQueue {
+	return &hostPriorityQueue{gates: newHostGateSet(maxInFlight, minDelay)}
+}
+
+// push enqueues link, belonging to host, ranked by score.
+func (q *hostPriorityQueue) push(link, host string, score int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	heap.Push(&q.items, &queueItem{link: link, host: host, score: score})
+}
+
+// popReady returns the highest-priority link whose host currently has
+// in-flight/delay headroom, acquiring that host's gate on the caller's
+// behalf (release it via release once the fetch completes). ok is false if
+// the queue is empty or every remaining item's host is currently gated —
+// the caller should back off briefly and retry rather than treat that as done.
+func (q *hostPriorityQueue) popReady() (link, host string, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var deferred []*queueItem
+	for q.items.Len() > 0 {
+		it := heap.Pop(&q.items).(*queueItem)
+		if q.gates.tryAcquire(it.host) {
+			for _, d := range deferred {
+				heap.Push(&q.items, d)
+			}
+			return it.link, it.host, true
+		}
+		deferred = append(deferred, it)
+	}
+	for _, d := range deferred {
+		heap.Push(&q.items, d)
+	}
+	return "", "", false
+}
+
+// release returns host's in-flight slot after a fetch completes.
+func (q *hostPriorityQueue) release(host string) {
+	q.gates.release(host)
+}
+
+// pending reports how many items are still queued (whether or not any are
+// currently ready), so callers can tell "temporarily throttled" apart from
+// "nothing left to do".
+func (q *hostPriorityQueue) pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.items.Len()
+}
+
+// linkScore ranks a discovered URL for hostPriorityQueue: the seed always
+// goes first, then links ordered by path depth (shallower paths first), with
+// a sitemap-derived URL ranked ahead of an ordinary link of the same depth.
+func linkScore(rawURL string, isSeed, fromSitemap bool) int {
+	if isSeed {
+		return -10 // below the lowest sitemap score (depth 0: -5)
+	}
+	depth := pathDepth(rawURL)
+	if fromSitemap {
+		return depth*10 - 5
+	}
+	return depth * 10
+}
+
+func pathDepth(rawURL string) int {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0
+	}
+	trimmed := strings.Trim(u.Path, "/")
+	if trimmed == "" {
+		return 0
+	}
+	return len(strings.Split(trimmed, "/"))
+}
@@ -1,5 +1,7 @@
 package lib
 
+import "net/http"
+
 // FetchRequest represents an incoming fetch request
 type FetchRequest struct {
 	Urls []string `json:"urls"`
@@ -7,10 +9,12 @@ type FetchRequest struct {
 
 // PageContent represents the content of a fetched page
 type PageContent struct {
-	URL         string `json:"url"`
-	HTML        string `json:"html"`
-	Error       string `json:"error,omitempty"`
-	ContentType string `json:"content_type,omitempty"`
+	URL         string      `json:"url"`
+	HTML        string      `json:"html"`
+	Error       string      `json:"error,omitempty"`
+	ContentType string      `json:"content_type,omitempty"`
+	StatusCode  int         `json:"status_code,omitempty"`
+	Headers     http.Header `json:"headers,omitempty"`
 }
 
 // PageMetadata describes an entry embedded inside the compressed archive
@@ -21,6 +25,11 @@ type PageMetadata struct {
 	Error       string `json:"error,omitempty"`
 	SizeBytes   int    `json:"size_bytes,omitempty"`
 	HasHTML     bool   `json:"has_html"`
+
+	// Populated only for ArchiveFormat: "warc" batches, straight from the
+	// record's own WARC headers.
+	WARCRecordID      string `json:"warc_record_id,omitempty"`
+	WARCPayloadDigest string `json:"warc_payload_digest,omitempty"`
 }
 
 // BatchStats provides a quick overview of successes and failures
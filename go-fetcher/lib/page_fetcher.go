@@ -2,16 +2,24 @@ package lib
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"mime"
 	"net/http"
 	"strings"
+	"time"
+
+	"go-fetcher/lib/recorder"
 )
 
+// crawlerUserAgent is sent on every outgoing fetch and recorded into WARC request records.
+const crawlerUserAgent = "go-crawler/3.0 (+SSE)"
+
 // PageFetcher handles fetching pages from the web
 type PageFetcher struct {
 	httpClient  *http.Client
 	maxPageBytes int64
+	recorder    recorder.Recorder
 }
 
 // NewPageFetcher creates a new page fetcher
@@ -22,12 +30,25 @@ func NewPageFetcher(httpClient *http.Client, maxPageBytes int64) *PageFetcher {
 	}
 }
 
-// FetchPage fetches a page and returns its content
-func (pf *PageFetcher) FetchPage(target string) PageContent {
-	req, _ := http.NewRequest(http.MethodGet, target, nil)
-	req.Header.Set("User-Agent", "go-crawler/3.0 (+SSE)")
+// SetRecorder enables capturing every fetch this PageFetcher makes for requestID,
+// so a failed crawl can be reproduced later. Pass nil to disable.
+func (pf *PageFetcher) SetRecorder(r recorder.Recorder) {
+	pf.recorder = r
+}
+
+// FetchPage fetches a page and returns its content. ctx is honored by the
+// underlying HTTP call, so a cancelled ctx aborts an in-flight fetch instead
+// of letting it run to completion.
+func (pf *PageFetcher) FetchPage(ctx context.Context, requestID, target string) PageContent {
+	started := time.Now()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	req.Header.Set("User-Agent", crawlerUserAgent)
 	resp, err := pf.httpClient.Do(req)
 	if err != nil {
+		pf.record(requestID, recorder.FetchRecord{
+			URL: target, Method: http.MethodGet, RequestHeaders: req.Header.Clone(),
+			Error: err.Error(), Duration: time.Since(started),
+		})
 		return PageContent{URL: target, Error: err.Error()}
 	}
 	defer resp.Body.Close()
@@ -43,8 +64,21 @@ func (pf *PageFetcher) FetchPage(target string) PageContent {
 	_, _ = io.Copy(&buf, io.LimitReader(resp.Body, pf.maxPageBytes))
 	html := buf.String()
 
+	pf.record(requestID, recorder.FetchRecord{
+		URL: target, Method: http.MethodGet, RequestHeaders: req.Header.Clone(),
+		StatusCode: resp.StatusCode, ResponseHeaders: resp.Header,
+		ResponseBody: buf.Bytes(), Duration: time.Since(started),
+	})
+
 	// HTML pages are no longer saved to MinIO in go-fetcher
 	// They will be saved by python-analyzer only when hits are detected
 
-	return PageContent{URL: target, HTML: html, ContentType: ct}
+	return PageContent{URL: target, HTML: html, ContentType: ct, StatusCode: resp.StatusCode, Headers: resp.Header}
+}
+
+func (pf *PageFetcher) record(requestID string, rec recorder.FetchRecord) {
+	if pf.recorder == nil {
+		return
+	}
+	pf.recorder.RecordFetch(requestID, rec)
 }
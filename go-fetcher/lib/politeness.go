@@ -0,0 +1,299 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// robotsRules is the subset of a robots.txt file that applies to our user-agent.
+type robotsRules struct {
+	Allow      []string      `json:"allow,omitempty"`
+	Disallow   []string      `json:"disallow,omitempty"`
+	CrawlDelay time.Duration `json:"crawl_delay,omitempty"`
+	Sitemaps   []string      `json:"sitemaps,omitempty"`
+}
+
+// hostPolicy is the cached robots.txt result and pacing state for one host.
+type hostPolicy struct {
+	rules     robotsRules
+	expiresAt time.Time
+	limiter   *hostLimiter
+}
+
+// PolitenessManager fetches and caches robots.txt per host, answers whether a
+// URL may be crawled, discovers sitemaps, and paces per-host requests so one
+// seed can't hammer a host faster than it allows.
+type PolitenessManager struct {
+	httpClient   *http.Client
+	userAgent    string
+	defaultDelay time.Duration
+	ttl          time.Duration
+	redisClient  *redis.Client // optional, shares robots.txt across instances
+
+	mu    sync.Mutex
+	hosts map[string]*hostPolicy
+}
+
+// NewPolitenessManager creates a manager that paces requests to at least
+// defaultDelay apart per host, refetching robots.txt after ttl. redisClient may
+// be nil, in which case the cache is in-process only.
+func NewPolitenessManager(httpClient *http.Client, userAgent string, defaultDelay, ttl time.Duration, redisClient *redis.Client) *PolitenessManager {
+	return &PolitenessManager{
+		httpClient:   httpClient,
+		userAgent:    userAgent,
+		defaultDelay: defaultDelay,
+		ttl:          ttl,
+		redisClient:  redisClient,
+		hosts:        make(map[string]*hostPolicy),
+	}
+}
+
+// Allowed reports whether robots.txt permits fetching rawURL.
+func (pm *PolitenessManager) Allowed(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return true
+	}
+	p := pm.policyFor(u.Host, u.Scheme)
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	allow := longestMatch(p.rules.Allow, path)
+	disallow := longestMatch(p.rules.Disallow, path)
+	return disallow <= allow
+}
+
+// Wait blocks until rawURL's host is due for its next request.
+func (pm *PolitenessManager) Wait(rawURL string) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return
+	}
+	pm.policyFor(u.Host, u.Scheme).limiter.wait()
+}
+
+// Sitemaps returns the Sitemap: URLs robots.txt advertised for rawURL's host.
+func (pm *PolitenessManager) Sitemaps(rawURL string) []string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+	return pm.policyFor(u.Host, u.Scheme).rules.Sitemaps
+}
+
+// FetchSitemap downloads and XML-parses a sitemap, returning its <loc> entries.
+func (pm *PolitenessManager) FetchSitemap(sitemapURL string) []string {
+	req, err := http.NewRequest(http.MethodGet, sitemapURL, nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("User-Agent", pm.userAgent)
+
+	resp, err := pm.httpClient.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 10*1024*1024))
+	if err != nil {
+		return nil
+	}
+
+	var set struct {
+		URLs []struct {
+			Loc string `xml:"loc"`
+		} `xml:"url"`
+	}
+	if err := xml.Unmarshal(body, &set); err != nil {
+		return nil
+	}
+
+	locs := make([]string, 0, len(set.URLs))
+	for _, u := range set.URLs {
+		if loc := strings.TrimSpace(u.Loc); loc != "" {
+			locs = append(locs, loc)
+		}
+	}
+	return locs
+}
+
+// policyFor returns host's cached policy, refetching robots.txt if it's missing or stale.
+func (pm *PolitenessManager) policyFor(host, scheme string) *hostPolicy {
+	pm.mu.Lock()
+	if p, ok := pm.hosts[host]; ok && time.Now().Before(p.expiresAt) {
+		pm.mu.Unlock()
+		return p
+	}
+	pm.mu.Unlock()
+
+	rules := pm.fetchRobots(host, scheme)
+	delay := pm.defaultDelay
+	if rules.CrawlDelay > delay {
+		delay = rules.CrawlDelay
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	p, ok := pm.hosts[host]
+	if !ok {
+		p = &hostPolicy{limiter: newHostLimiter(delay)}
+		pm.hosts[host] = p
+	}
+	p.rules = rules
+	p.expiresAt = time.Now().Add(pm.ttl)
+	p.limiter.setInterval(delay)
+	return p
+}
+
+func (pm *PolitenessManager) fetchRobots(host, scheme string) robotsRules {
+	cacheKey := "robots:" + host
+
+	if pm.redisClient != nil {
+		if cached, err := pm.redisClient.Get(context.Background(), cacheKey).Bytes(); err == nil {
+			var rules robotsRules
+			if json.Unmarshal(cached, &rules) == nil {
+				return rules
+			}
+		}
+	}
+
+	robotsURL := fmt.Sprintf("%s://%s/robots.txt", scheme, host)
+	req, err := http.NewRequest(http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return robotsRules{}
+	}
+	req.Header.Set("User-Agent", pm.userAgent)
+
+	resp, err := pm.httpClient.Do(req)
+	if err != nil {
+		return robotsRules{}
+	}
+	defer resp.Body.Close()
+
+	// No robots.txt, or the host rejected us fetching it: treat as allow-all.
+	if resp.StatusCode >= 400 {
+		return robotsRules{}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 512*1024))
+	if err != nil {
+		return robotsRules{}
+	}
+	rules := parseRobots(body, pm.userAgent)
+
+	if pm.redisClient != nil {
+		if data, err := json.Marshal(rules); err == nil {
+			pm.redisClient.Set(context.Background(), cacheKey, data, pm.ttl)
+		}
+	}
+	return rules
+}
+
+// parseRobots extracts the Allow/Disallow/Crawl-delay rules that apply to ua,
+// plus every Sitemap: directive (those apply regardless of user-agent group).
+func parseRobots(body []byte, ua string) robotsRules {
+	var rules robotsRules
+	applies := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		val := strings.TrimSpace(parts[1])
+
+		switch key {
+		case "user-agent":
+			applies = val == "*" || strings.EqualFold(val, ua) || strings.HasPrefix(strings.ToLower(ua), strings.ToLower(val))
+		case "disallow":
+			if applies && val != "" {
+				rules.Disallow = append(rules.Disallow, val)
+			}
+		case "allow":
+			if applies && val != "" {
+				rules.Allow = append(rules.Allow, val)
+			}
+		case "crawl-delay":
+			if applies {
+				if secs, err := strconv.ParseFloat(val, 64); err == nil {
+					rules.CrawlDelay = time.Duration(secs * float64(time.Second))
+				}
+			}
+		case "sitemap":
+			rules.Sitemaps = append(rules.Sitemaps, val)
+		}
+	}
+	return rules
+}
+
+func longestMatch(rules []string, path string) int {
+	best := -1
+	for _, r := range rules {
+		if r != "" && strings.HasPrefix(path, r) && len(r) > best {
+			best = len(r)
+		}
+	}
+	return best
+}
+
+// hostLimiter paces requests to one host to at least interval apart, acting as
+// the token bucket workers block on before calling PageFetcher.FetchPage.
+type hostLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newHostLimiter(interval time.Duration) *hostLimiter {
+	return &hostLimiter{interval: interval}
+}
+
+func (hl *hostLimiter) setInterval(interval time.Duration) {
+	hl.mu.Lock()
+	hl.interval = interval
+	hl.mu.Unlock()
+}
+
+func (hl *hostLimiter) wait() {
+	hl.mu.Lock()
+	now := time.Now()
+	if hl.next.IsZero() || !now.Before(hl.next) {
+		hl.next = now.Add(hl.interval)
+		hl.mu.Unlock()
+		return
+	}
+	sleepUntil := hl.next
+	hl.next = hl.next.Add(hl.interval)
+	hl.mu.Unlock()
+	time.Sleep(time.Until(sleepUntil))
+}
@@ -0,0 +1,265 @@
+// Package recorder captures the exact upstream fetches and analyzer upload that
+// produced a crawl, so a failed batch sitting in the dead letter queue can be
+// turned into a reproducible tarball instead of a dead end.
+package recorder
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FetchRecord captures one outgoing page fetch and the raw upstream response.
+type FetchRecord struct {
+	URL             string
+	Method          string
+	RequestHeaders  http.Header
+	StatusCode      int
+	ResponseHeaders http.Header
+	ResponseBody    []byte
+	Error           string
+	Duration        time.Duration
+}
+
+// PageEntry is the manifest's summary of one recorded page fetch.
+type PageEntry struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Manifest describes one recorded crawl's tarball contents.
+type Manifest struct {
+	RequestID  string      `json:"request_id"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt time.Time   `json:"finished_at"`
+	Pages      []PageEntry `json:"pages"`
+}
+
+// Recorder captures crawl fetches and analyzer uploads so they can be replayed later.
+type Recorder interface {
+	// Force always records requestID regardless of the sampling rate.
+	Force(requestID string)
+	// RecordFetch appends one fetch/response pair, if requestID is selected for recording.
+	RecordFetch(requestID string, rec FetchRecord)
+	// RecordUpload stores the exact bytes POSTed to the analyzer, if requestID is selected for recording.
+	RecordUpload(requestID string, body []byte)
+	// Finalize writes the tarball to disk and forgets requestID's in-memory session.
+	// Returns an empty path if requestID was never selected for recording.
+	Finalize(requestID string, fetchRequest any) (string, error)
+}
+
+type session struct {
+	mu        sync.Mutex
+	startedAt time.Time
+	pages     []FetchRecord
+	upload    []byte
+}
+
+// TarRecorder is the on-disk Recorder: each crawl becomes a self-contained tarball
+// under dir containing the original request, a .req/.resp pair per page, the raw
+// bytes posted to the analyzer, and a manifest.json summary.
+type TarRecorder struct {
+	dir        string
+	sampleRate float64
+
+	mu       sync.Mutex
+	forced   map[string]struct{}
+	decided  map[string]bool
+	sessions map[string]*session
+}
+
+// New creates a recorder that writes tarballs under dir, sampling a fraction
+// sampleRate of requestIDs (0..1) unless Force was called for that request_id.
+func New(dir string, sampleRate float64) *TarRecorder {
+	return &TarRecorder{
+		dir:        dir,
+		sampleRate: sampleRate,
+		forced:     make(map[string]struct{}),
+		decided:    make(map[string]bool),
+		sessions:   make(map[string]*session),
+	}
+}
+
+func (r *TarRecorder) Force(requestID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.forced[requestID] = struct{}{}
+	delete(r.decided, requestID)
+}
+
+// included reports (and caches) whether requestID should be recorded, so every
+// page of a crawl is captured consistently instead of re-rolling the dice per page.
+func (r *TarRecorder) included(requestID string) bool {
+	if decided, ok := r.decided[requestID]; ok {
+		return decided
+	}
+	_, forced := r.forced[requestID]
+	decided := forced || rand.Float64() < r.sampleRate
+	r.decided[requestID] = decided
+	return decided
+}
+
+func (r *TarRecorder) sessionLocked(requestID string) *session {
+	s, ok := r.sessions[requestID]
+	if !ok {
+		s = &session{startedAt: time.Now()}
+		r.sessions[requestID] = s
+	}
+	return s
+}
+
+func (r *TarRecorder) RecordFetch(requestID string, rec FetchRecord) {
+	r.mu.Lock()
+	var s *session
+	if r.included(requestID) {
+		s = r.sessionLocked(requestID)
+	}
+	r.mu.Unlock()
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.pages = append(s.pages, rec)
+	s.mu.Unlock()
+}
+
+func (r *TarRecorder) RecordUpload(requestID string, body []byte) {
+	r.mu.Lock()
+	var s *session
+	if r.included(requestID) {
+		s = r.sessionLocked(requestID)
+	}
+	r.mu.Unlock()
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.upload = append([]byte(nil), body...)
+	s.mu.Unlock()
+}
+
+func (r *TarRecorder) Finalize(requestID string, fetchRequest any) (string, error) {
+	r.mu.Lock()
+	s, ok := r.sessions[requestID]
+	delete(r.sessions, requestID)
+	delete(r.decided, requestID)
+	delete(r.forced, requestID)
+	r.mu.Unlock()
+	if !ok {
+		return "", nil
+	}
+
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return "", fmt.Errorf("create record dir: %w", err)
+	}
+
+	path := filepath.Join(r.dir, requestID+".tar")
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("create tarball: %w", err)
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	defer tw.Close()
+
+	reqJSON, err := json.MarshalIndent(fetchRequest, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("marshal request: %w", err)
+	}
+	if err := writeTarEntry(tw, "request.json", reqJSON); err != nil {
+		return "", err
+	}
+
+	manifest := Manifest{RequestID: requestID, StartedAt: s.startedAt, FinishedAt: time.Now()}
+
+	s.mu.Lock()
+	pages := s.pages
+	upload := s.upload
+	s.mu.Unlock()
+
+	for idx, p := range pages {
+		if err := writeTarEntry(tw, fmt.Sprintf("page-%04d.req", idx+1), renderRequest(p)); err != nil {
+			return "", err
+		}
+		if err := writeTarEntry(tw, fmt.Sprintf("page-%04d.resp", idx+1), renderResponse(p)); err != nil {
+			return "", err
+		}
+		manifest.Pages = append(manifest.Pages, PageEntry{
+			URL:        p.URL,
+			StatusCode: p.StatusCode,
+			Error:      p.Error,
+			DurationMS: p.Duration.Milliseconds(),
+		})
+	}
+
+	if upload != nil {
+		if err := writeTarEntry(tw, "analyzer-upload.bin", upload); err != nil {
+			return "", err
+		}
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("marshal manifest: %w", err)
+	}
+	if err := writeTarEntry(tw, "manifest.json", manifestJSON); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+func renderRequest(p FetchRecord) []byte {
+	method := p.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	text := fmt.Sprintf("%s %s HTTP/1.1\r\n", method, p.URL)
+	for k, vs := range p.RequestHeaders {
+		for _, v := range vs {
+			text += fmt.Sprintf("%s: %s\r\n", k, v)
+		}
+	}
+	return []byte(text + "\r\n")
+}
+
+func renderResponse(p FetchRecord) []byte {
+	status := p.StatusCode
+	if status == 0 {
+		status = 599 // synthetic: fetch never reached a status line (see p.Error)
+	}
+	text := fmt.Sprintf("HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+	for k, vs := range p.ResponseHeaders {
+		for _, v := range vs {
+			text += fmt.Sprintf("%s: %s\r\n", k, v)
+		}
+	}
+	text += "\r\n"
+	return append([]byte(text), p.ResponseBody...)
+}
+
+func writeTarEntry(tw *tar.Writer, name string, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Size:    int64(len(data)),
+		Mode:    0o644,
+		ModTime: time.Now(),
+	}); err != nil {
+		return fmt.Errorf("write tar header %s: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("write tar entry %s: %w", name, err)
+	}
+	return nil
+}
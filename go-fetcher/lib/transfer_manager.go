@@ -0,0 +1,95 @@
+package lib
+
+import (
+	"context"
+	"sync"
+)
+
+// transfer is one in-flight FetchPage call shared by every watcher currently
+// waiting on the same normalized URL.
+type transfer struct {
+	done     chan struct{}
+	result   PageContent
+	cancel   context.CancelFunc
+	mu       sync.Mutex
+	watchers int
+}
+
+// TransferManager deduplicates concurrent PageFetcher.FetchPage calls for the
+// same URL across all in-flight crawls: the first caller for a URL starts the
+// real fetch, and every later caller for that same URL while it's still
+// in-flight attaches as a watcher and receives the same result instead of
+// issuing its own request. A watcher giving up (its ctx is cancelled) only
+// cancels the underlying fetch once every watcher on it has given up.
+type TransferManager struct {
+	pageFetcher *PageFetcher
+
+	mu       sync.Mutex
+	inFlight map[string]*transfer
+}
+
+// NewTransferManager wraps pageFetcher with in-flight request deduplication.
+func NewTransferManager(pageFetcher *PageFetcher) *TransferManager {
+	return &TransferManager{
+		pageFetcher: pageFetcher,
+		inFlight:    make(map[string]*transfer),
+	}
+}
+
+// FetchPage fetches url, sharing the result with any other caller already
+// fetching the same url. requestID is only used for the watcher that ends up
+// actually starting the fetch (see PageFetcher.record); watchers that attach
+// to an existing transfer don't get their own requestID recorded against it.
+func (tm *TransferManager) FetchPage(ctx context.Context, requestID, url string) PageContent {
+	tm.mu.Lock()
+	tr, ok := tm.inFlight[url]
+	if ok {
+		tr.mu.Lock()
+		tr.watchers++
+		tr.mu.Unlock()
+		tm.mu.Unlock()
+	} else {
+		fetchCtx, cancel := context.WithCancel(context.Background())
+		tr = &transfer{done: make(chan struct{}), cancel: cancel, watchers: 1}
+		tm.inFlight[url] = tr
+		tm.mu.Unlock()
+
+		go func() {
+			tr.result = tm.pageFetcher.FetchPage(fetchCtx, requestID, url)
+			close(tr.done)
+
+			tm.mu.Lock()
+			if tm.inFlight[url] == tr {
+				delete(tm.inFlight, url)
+			}
+			tm.mu.Unlock()
+		}()
+	}
+
+	defer tm.dropWatcher(tr)
+
+	select {
+	case <-tr.done:
+		return tr.result
+	case <-ctx.Done():
+		return PageContent{URL: url, Error: ctx.Err().Error()}
+	}
+}
+
+// dropWatcher decrements tr's watcher count and cancels its shared fetch once
+// the last watcher has given up on it.
+func (tm *TransferManager) dropWatcher(tr *transfer) {
+	tr.mu.Lock()
+	tr.watchers--
+	remaining := tr.watchers
+	tr.mu.Unlock()
+
+	if remaining == 0 {
+		select {
+		case <-tr.done:
+			// Already finished; nothing to cancel.
+		default:
+			tr.cancel()
+		}
+	}
+}
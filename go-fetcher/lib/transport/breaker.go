@@ -0,0 +1,151 @@
+package transport
+
+import (
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+// hostBreaker tracks one host's recent failure history and trips from
+// closed -> open after too many consecutive failures land within Window,
+// then lets a single half-open probe through after Cooldown to decide
+// whether to close again.
+type hostBreaker struct {
+	config Config
+
+	mu                 sync.Mutex
+	state              breakerState
+	consecutiveFails   int
+	firstFailAt        time.Time
+	openedAt           time.Time
+	probeInFlight      bool
+	requests           int64
+	failures           int64
+	latencies          []time.Duration // ring of recent latencies, for p95
+}
+
+const latencyWindowSize = 100
+
+func newHostBreaker(config Config) *hostBreaker {
+	return &hostBreaker{config: config}
+}
+
+// open reports whether calls should be short-circuited right now, and if so
+// how much cooldown remains. A half-open probe is allowed through once per
+// cooldown period.
+func (hb *hostBreaker) open() (bool, time.Duration) {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+
+	if hb.state == stateClosed {
+		return false, 0
+	}
+
+	elapsed := time.Since(hb.openedAt)
+	if elapsed < hb.config.Cooldown {
+		return true, hb.config.Cooldown - elapsed
+	}
+
+	if hb.probeInFlight {
+		return true, 0
+	}
+
+	hb.state = stateHalfOpen
+	hb.probeInFlight = true
+	return false, 0
+}
+
+func (hb *hostBreaker) recordSuccess() {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+
+	hb.requests++
+	hb.consecutiveFails = 0
+	hb.probeInFlight = false
+	hb.state = stateClosed
+}
+
+func (hb *hostBreaker) recordFailure() {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+
+	hb.requests++
+	hb.failures++
+	hb.probeInFlight = false
+
+	now := time.Now()
+	if hb.consecutiveFails == 0 || now.Sub(hb.firstFailAt) > hb.config.Window {
+		hb.firstFailAt = now
+		hb.consecutiveFails = 0
+	}
+	hb.consecutiveFails++
+
+	if hb.state == stateHalfOpen || hb.consecutiveFails >= hb.config.FailureThresh {
+		hb.state = stateOpen
+		hb.openedAt = now
+	}
+}
+
+// HostStats is a point-in-time snapshot of one host's transport health.
+type HostStats struct {
+	Requests   int64      `json:"requests"`
+	Failures   int64      `json:"failures"`
+	Open       bool       `json:"open"`
+	OpenSince  *time.Time `json:"open_since,omitempty"`
+	P95Latency string     `json:"p95_latency,omitempty"`
+}
+
+func (hb *hostBreaker) stats() HostStats {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+
+	s := HostStats{
+		Requests: hb.requests,
+		Failures: hb.failures,
+		Open:     hb.state == stateOpen,
+	}
+	if s.Open {
+		openedAt := hb.openedAt
+		s.OpenSince = &openedAt
+	}
+	if p95 := percentile(hb.latencies, 0.95); p95 > 0 {
+		s.P95Latency = p95.String()
+	}
+	return s
+}
+
+func (hb *hostBreaker) observeLatency(d time.Duration) {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	hb.latencies = append(hb.latencies, d)
+	if len(hb.latencies) > latencyWindowSize {
+		hb.latencies = hb.latencies[len(hb.latencies)-latencyWindowSize:]
+	}
+}
+
+// percentile does a simple sort-and-index; the window is capped at
+// latencyWindowSize so this stays cheap even on the stats-read path.
+func percentile(samples []time.Duration, p float64) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	for i := 1; i < len(sorted); i++ {
+		for j := i; j > 0 && sorted[j-1] > sorted[j]; j-- {
+			sorted[j-1], sorted[j] = sorted[j], sorted[j-1]
+		}
+	}
+	idx := int(p * float64(len(sorted)))
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
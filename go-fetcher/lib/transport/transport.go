@@ -0,0 +1,216 @@
+// Package transport provides an http.RoundTripper that retries transient
+// upstream failures and trips a per-host circuit breaker when a host keeps
+// failing, so one flaky domain can't tie up every worker with slow retries.
+package transport
+
+import (
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config tunes RoundTripper's retry and circuit-breaking behavior.
+type Config struct {
+	MaxRetries      int           // idempotent-request retries before giving up, not counting the first attempt
+	BaseBackoff     time.Duration // backoff before the first retry, multiplied by Multiplier each subsequent attempt
+	MaxBackoff      time.Duration // backoff is capped here regardless of attempt count
+	Multiplier      float64       // backoff growth factor per attempt; 0 defaults to 2 (see Backoff)
+	FailureThresh   int           // consecutive 5xx/timeout responses within Window before the breaker opens
+	Window          time.Duration // sliding window consecutive failures must fall within to count
+	Cooldown        time.Duration // how long the breaker stays open before allowing a half-open probe
+}
+
+// DefaultConfig returns sane defaults for crawling third-party sites.
+func DefaultConfig() Config {
+	return Config{
+		MaxRetries:    3,
+		BaseBackoff:   200 * time.Millisecond,
+		MaxBackoff:    5 * time.Second,
+		Multiplier:    2,
+		FailureThresh: 5,
+		Window:        30 * time.Second,
+		Cooldown:      30 * time.Second,
+	}
+}
+
+// RoundTripper wraps an underlying http.RoundTripper (usually *http.Transport)
+// with retries on transient errors/5xx and a per-host circuit breaker.
+type RoundTripper struct {
+	next   http.RoundTripper
+	config Config
+
+	mu    sync.Mutex
+	hosts map[string]*hostBreaker
+}
+
+// New wraps next with retry and circuit-breaking behavior. next is typically
+// the *http.Transport already built in config.Init.
+func New(next http.RoundTripper, config Config) *RoundTripper {
+	return &RoundTripper{
+		next:   next,
+		config: config,
+		hosts:  make(map[string]*hostBreaker),
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	hb := rt.breakerFor(host)
+
+	if open, cooldownLeft := hb.open(); open {
+		return circuitOpenResponse(req, cooldownLeft), nil
+	}
+
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead
+	var lastResp *http.Response
+	var lastErr error
+
+	attempts := 1
+	if idempotent {
+		attempts += rt.config.MaxRetries
+	}
+
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(rt.retryDelay(attempt, lastResp))
+		}
+
+		started := time.Now()
+		resp, err := rt.next.RoundTrip(cloneRequest(req))
+		hb.observeLatency(time.Since(started))
+		if err == nil && !isRetriableStatus(resp.StatusCode) {
+			if resp.StatusCode >= 500 {
+				hb.recordFailure() // counts toward the breaker, but isn't retried
+			} else {
+				hb.recordSuccess()
+			}
+			return resp, nil
+		}
+
+		if err != nil && !isTransientNetErr(err) {
+			hb.recordFailure()
+			return nil, err
+		}
+
+		hb.recordFailure()
+		lastResp, lastErr = resp, err
+
+		if attempt == attempts-1 {
+			break
+		}
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+	}
+
+	return lastResp, lastErr
+}
+
+func (rt *RoundTripper) retryDelay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if ra := resp.Header.Get("Retry-After"); ra != "" {
+			if secs, err := strconv.Atoi(ra); err == nil {
+				return time.Duration(secs) * time.Second
+			}
+		}
+	}
+
+	return Backoff(attempt, rt.config.BaseBackoff, rt.config.MaxBackoff, rt.config.Multiplier)
+}
+
+// Backoff computes a full-jitter exponential backoff for the given attempt
+// (1-indexed): base * multiplier^(attempt-1), capped at max. multiplier <= 0
+// defaults to 2 (plain doubling). Exposed so callers that can't route a
+// request through RoundTripper (e.g. a streaming POST body that can't be
+// replayed, or DLQ redelivery) can still share the same retry math.
+func Backoff(attempt int, base, max time.Duration, multiplier float64) time.Duration {
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	backoff := float64(base) * math.Pow(multiplier, float64(attempt-1))
+	if backoff > float64(max) {
+		backoff = float64(max)
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+func (rt *RoundTripper) breakerFor(host string) *hostBreaker {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	hb, ok := rt.hosts[host]
+	if !ok {
+		hb = newHostBreaker(rt.config)
+		rt.hosts[host] = hb
+	}
+	return hb
+}
+
+// Stats returns a snapshot of every host this transport has seen traffic for.
+func (rt *RoundTripper) Stats() map[string]HostStats {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	out := make(map[string]HostStats, len(rt.hosts))
+	for host, hb := range rt.hosts {
+		out[host] = hb.stats()
+	}
+	return out
+}
+
+func isRetriableStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+// circuitOpenResponse synthesizes a 503 in place of the real call, so callers
+// see an ordinary (if unretryable) HTTP error instead of blocking on a host
+// that's known to be down.
+func circuitOpenResponse(req *http.Request, cooldownLeft time.Duration) *http.Response {
+	body := `{"error":"circuit_open","retry_after_seconds":` + strconv.Itoa(int(cooldownLeft.Seconds()+1)) + `}`
+	return &http.Response{
+		Status:     "503 circuit_open",
+		StatusCode: http.StatusServiceUnavailable,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+}
+
+func cloneRequest(req *http.Request) *http.Request {
+	clone := req.Clone(req.Context())
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err == nil {
+			clone.Body = body
+		}
+	}
+	return clone
+}
+
+// isTransientNetErr reports whether err looks like a transient dial/EOF
+// failure worth retrying, mirroring the classification AnalyzerClient already
+// applies to its own retry loop.
+func isTransientNetErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	if ne, ok := err.(net.Error); ok && (ne.Temporary() || ne.Timeout()) {
+		return true
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "connection reset") ||
+		strings.Contains(msg, "unexpected EOF") ||
+		strings.Contains(msg, "broken pipe") ||
+		strings.Contains(msg, "timeout") ||
+		strings.Contains(msg, "EOF")
+}
@@ -0,0 +1,146 @@
+package lib
+
+import (
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WARC record types produced by WARCWriter.
+const (
+	warcTypeInfo     = "warcinfo"
+	warcTypeRequest  = "request"
+	warcTypeResponse = "response"
+	warcTypeMetadata = "metadata"
+	warcTypeResource = "resource"
+)
+
+// WARCWriter streams WARC/1.1 records straight into an underlying writer so a
+// batch never needs to be fully materialized before it starts going out. Each
+// record is gzipped independently (the WARC norm for a .warc.gz file, so a
+// reader can seek to and decompress any one record without touching the
+// rest of the archive); the underlying writer sees a concatenation of
+// self-contained gzip members, which any gzip reader still decompresses as
+// one continuous stream.
+type WARCWriter struct {
+	w io.Writer
+}
+
+// NewWARCWriter wraps w so WriteWarcinfo/WriteRequest/WriteResponse/WriteMetadata append records to it.
+func NewWARCWriter(w io.Writer) *WARCWriter {
+	return &WARCWriter{w: w}
+}
+
+// recordInfo describes the record writeRecord just wrote, so callers can
+// surface it in PageMetadata without re-parsing the WARC headers.
+type recordInfo struct {
+	ID            string
+	TargetURI     string
+	ContentLength int
+	PayloadDigest string
+}
+
+// WriteWarcinfo emits the single warcinfo record a batch must lead with.
+func (ww *WARCWriter) WriteWarcinfo(seedURL string) (recordInfo, error) {
+	body := []byte(fmt.Sprintf(
+		"software: %s\r\nformat: WARC File Format 1.1\r\nseed: %s\r\n",
+		crawlerUserAgent, seedURL,
+	))
+	return ww.writeRecord(warcTypeInfo, "", "application/warc-fields", body, body)
+}
+
+// WriteRequest emits a request record describing the fetch we issued for targetURI.
+func (ww *WARCWriter) WriteRequest(targetURI string, headers http.Header) (recordInfo, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "GET %s HTTP/1.1\r\n", targetURI)
+	fmt.Fprintf(&b, "User-Agent: %s\r\n", crawlerUserAgent)
+	for k, vs := range headers {
+		for _, v := range vs {
+			fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+		}
+	}
+	b.WriteString("\r\n")
+	body := []byte(b.String())
+	return ww.writeRecord(warcTypeRequest, targetURI, "application/http; msgtype=request", body, []byte{})
+}
+
+// WriteResponse emits a response record carrying the raw status line, headers and body.
+func (ww *WARCWriter) WriteResponse(targetURI string, statusCode int, headers http.Header, payload []byte) (recordInfo, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "HTTP/1.1 %d %s\r\n", statusCode, http.StatusText(statusCode))
+	for k, vs := range headers {
+		for _, v := range vs {
+			fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+		}
+	}
+	b.WriteString("\r\n")
+	b.Write(payload)
+	return ww.writeRecord(warcTypeResponse, targetURI, "application/http; msgtype=response", []byte(b.String()), payload)
+}
+
+// WriteMetadata emits a metadata record referencing targetURI, used in place
+// of a response record when a fetch failed so the failure still shows up in
+// the archive instead of silently vanishing.
+func (ww *WARCWriter) WriteMetadata(targetURI, message string) (recordInfo, error) {
+	body := []byte(message)
+	return ww.writeRecord(warcTypeMetadata, targetURI, "application/warc-fields", body, body)
+}
+
+// WriteResource emits a generic resource record carrying an arbitrary
+// content-type body. SendWARCBatch uses this to append a trailing JSON
+// manifest after a batch's real records, since a WARC stream otherwise has
+// nowhere to carry bookkeeping like request/batch IDs or stats.
+func (ww *WARCWriter) WriteResource(targetURI, contentType string, body []byte) (recordInfo, error) {
+	return ww.writeRecord(warcTypeResource, targetURI, contentType, body, body)
+}
+
+// writeRecord writes a single WARC/1.1 record — mandatory headers, a blank
+// line, body, then the "\r\n\r\n" record terminator — into its own gzip
+// member. payload is what WARC-Payload-Digest is computed over, which is not
+// always the same as the full record body.
+func (ww *WARCWriter) writeRecord(recordType, targetURI, contentType string, body, payload []byte) (recordInfo, error) {
+	id := uuid.New().String()
+	headers := []string{
+		"WARC/1.1",
+		"WARC-Type: " + recordType,
+		"WARC-Record-ID: <urn:uuid:" + id + ">",
+		"WARC-Date: " + time.Now().UTC().Format(time.RFC3339),
+		fmt.Sprintf("Content-Length: %d", len(body)),
+		"Content-Type: " + contentType,
+	}
+	if targetURI != "" {
+		headers = append(headers, "WARC-Target-URI: "+targetURI)
+	}
+	var digest string
+	if payload != nil {
+		sum := sha1.Sum(payload)
+		digest = "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+		headers = append(headers, "WARC-Payload-Digest: "+digest)
+	}
+
+	gw := gzip.NewWriter(ww.w)
+	if _, err := io.WriteString(gw, strings.Join(headers, "\r\n")+"\r\n\r\n"); err != nil {
+		_ = gw.Close()
+		return recordInfo{}, err
+	}
+	if _, err := gw.Write(body); err != nil {
+		_ = gw.Close()
+		return recordInfo{}, err
+	}
+	if _, err := io.WriteString(gw, "\r\n\r\n"); err != nil {
+		_ = gw.Close()
+		return recordInfo{}, err
+	}
+	if err := gw.Close(); err != nil {
+		return recordInfo{}, err
+	}
+
+	return recordInfo{ID: id, TargetURI: targetURI, ContentLength: len(body), PayloadDigest: digest}, nil
+}
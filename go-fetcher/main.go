@@ -10,6 +10,8 @@ import (
 
 	"go-fetcher/config"
 	"go-fetcher/lib"
+	"go-fetcher/lib/recorder"
+	"go-fetcher/lib/transport"
 )
 
 var (
@@ -50,20 +52,63 @@ func init() {
 
 	// Initialize all application components
 	eventHub = lib.NewEventHub()
+	eventHub.SetRedis(redisClient, cfg.EventStreamTTL, cfg.EventStreamMaxLen)
 	pageFetcher = lib.NewPageFetcher(cfg.HTTPClient, cfg.MaxPageBytes)
 	analyzerCli = lib.NewAnalyzerClient(cfg.AnalyzerClient, cfg.AnalyzerURL, cfg.AnalyzerGzip)
 	analyzerCli.SetEventHub(eventHub)  // ✅ Set event hub for failure notifications
-	crawler = lib.NewCrawler(pageFetcher, analyzerCli, eventHub, lib.CrawlerConfig{
-		BatchSize:       cfg.BatchSize,
-		ProgressEveryN:  cfg.ProgressEveryN,
-		PerSeedWorkers:  cfg.PerSeedWorkers,
-		MaxPagesPerSeed: cfg.MaxPagesPerSeed,
+	var politenessManager *lib.PolitenessManager
+	if cfg.RobotsEnabled {
+		politenessManager = lib.NewPolitenessManager(
+			cfg.HTTPClient,
+			cfg.RobotsOverrideUA,
+			time.Duration(cfg.RobotsDefaultDelayMS)*time.Millisecond,
+			time.Hour,
+			redisClient,
+		)
+		log.Printf("✅ Robots.txt politeness enabled (ua=%s, default_delay=%dms)", cfg.RobotsOverrideUA, cfg.RobotsDefaultDelayMS)
+	} else {
+		log.Printf("⚠️ Robots.txt politeness disabled")
+	}
+
+	var frontier lib.Frontier
+	if redisClient != nil {
+		redisFrontier := lib.NewRedisFrontier(redisClient, cfg.FrontierTTL)
+		frontier = redisFrontier
+		log.Printf("✅ Persistent crawl frontier enabled (ttl=%s)", cfg.FrontierTTL)
+	} else {
+		log.Printf("⚠️ Persistent crawl frontier disabled (Redis unavailable); crawls won't survive a restart")
+	}
+
+	crawler = lib.NewCrawler(pageFetcher, analyzerCli, eventHub, politenessManager, frontier, lib.CrawlerConfig{
+		BatchSize:         cfg.BatchSize,
+		ProgressEveryN:    cfg.ProgressEveryN,
+		PerSeedWorkers:    cfg.PerSeedWorkers,
+		MaxPagesPerSeed:   cfg.MaxPagesPerSeed,
+		ArchiveFormat:     cfg.OutputFormat,
+		StreamUpload:      cfg.StreamUpload,
+		RespectRobots:     cfg.RobotsEnabled,
+		DefaultCrawlDelay: time.Duration(cfg.RobotsDefaultDelayMS) * time.Millisecond,
+		HostConcurrency:   cfg.HostConcurrency,
 	})
 	handler = lib.NewHandler(crawler, eventHub, cfg.MaxGlobalCrawls)
+	handler.SetTransports(map[string]*transport.RoundTripper{
+		"crawl":    cfg.CrawlTransport,
+		"analyzer": cfg.AnalyzerTransport,
+	})
+	handler.SetActiveRegistry(redisClient, frontier, cfg.ActiveLeaseTTL)
+
+	// Crawl recorder: off by default, enabled by setting RECORD_DIR
+	if cfg.RecordDir != "" {
+		crawlRecorder := recorder.New(cfg.RecordDir, cfg.RecordSampleRate)
+		pageFetcher.SetRecorder(crawlRecorder)
+		analyzerCli.SetRecorder(crawlRecorder)
+		handler.SetRecorder(crawlRecorder)
+		log.Printf("✅ Crawl recorder enabled (dir=%s, sample=%.4f)", cfg.RecordDir, cfg.RecordSampleRate)
+	}
 
 	// Initialize Dead Letter Queue for failed batch delivery
 	if redisClient != nil {
-		deadLetterQueue = lib.NewDeadLetterQueue(redisClient, "dlq:failed-batches")
+		deadLetterQueue = lib.NewDeadLetterQueue(redisClient, "dlq:failed-batches", cfg.DLQBaseBackoff, cfg.DLQMaxBackoff, cfg.DLQMultiplier, cfg.DLQMaxRetries)
 		log.Printf("✅ Dead Letter Queue initialized")
 	} else {
 		log.Printf("⚠️ Dead Letter Queue disabled (Redis unavailable)")
@@ -95,15 +140,21 @@ func startDLQWorker() {
 }
 
 func main() {
+	// Resume any crawl whose owner crashed mid-run before its lease expired
+	handler.ResumeExpired()
+
 	// Start DLQ worker for periodic retry
 	startDLQWorker()
 
 	// Setup HTTP routes with CORS middleware
 	mux := http.NewServeMux()
 	mux.HandleFunc("/fetch", lib.WithCORS(cfg.AllowedOrigin, handler.HandleFetch))
+	mux.HandleFunc("/fetch/", lib.WithCORS(cfg.AllowedOrigin, handler.HandleFetchControl))
 	mux.HandleFunc("/events", lib.WithCORS(cfg.AllowedOrigin, handler.HandleSSEAll))
 	mux.HandleFunc("/events/", lib.WithCORS(cfg.AllowedOrigin, handler.HandleSSEByRequest))
 	mux.HandleFunc("/active", lib.WithCORS(cfg.AllowedOrigin, handler.HandleActiveRequests))
+	mux.HandleFunc("/debug/record/", lib.WithCORS(cfg.AllowedOrigin, handler.HandleDebugRecord))
+	mux.HandleFunc("/transport/stats", lib.WithCORS(cfg.AllowedOrigin, handler.HandleTransportStats))
 
 	// Start server
 	log.Printf("go-crawler (SSE) running on :%s [workers=%d, per_seed=%d, batch=%d, max_pages=%d, analyzer_conc=%d]",
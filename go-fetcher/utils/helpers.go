@@ -26,6 +26,18 @@ func EnvInt(key string, fallback int) int {
 	return fallback
 }
 
+// EnvFloat retrieves environment variable as a float64 or returns fallback
+func EnvFloat(key string, fallback float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		var n float64
+		_, _ = fmt.Sscanf(v, "%f", &n)
+		if n > 0 {
+			return n
+		}
+	}
+	return fallback
+}
+
 // SameHost checks if two hosts are the same (case-insensitive)
 func SameHost(a, b string) bool {
 	return strings.EqualFold(a, b)